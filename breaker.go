@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker fast-fails calls to an endpoint that keeps failing. After
+// threshold consecutive failures the circuit opens and calls fail at once
+// for cooldown, then a single trial call is let through: its success closes
+// the circuit again, its failure reopens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// breakerSnapshot is the state of a circuitBreaker kept in snapshots
+type breakerSnapshot struct {
+	State    circuitState
+	Failures int
+	OpenedAt time.Time
+}
+
+func (b *circuitBreaker) snapshot() breakerSnapshot {
+	return breakerSnapshot{
+		State:    b.state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+}
+
+func (b *circuitBreaker) restore(s breakerSnapshot) {
+	b.state = s.State
+	b.failures = s.Failures
+	b.openedAt = s.OpenedAt
+}
+
+// allow returns errCircuitOpen if a call must not be attempted now
+func (b *circuitBreaker) allow(now time.Time) error {
+	if b.state == circuitOpen {
+		if now.Sub(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.state = circuitHalfOpen
+	}
+	return nil
+}
+
+// record updates the state with the outcome of an allowed call
+func (b *circuitBreaker) record(err error, now time.Time) {
+	if err == nil {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failure := errors.New("connection refused")
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, 10*time.Second)
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(start); err != nil {
+			t.Fatalf("allow before threshold: %v", err)
+		}
+		b.record(failure, start)
+	}
+	if err := b.allow(start.Add(5 * time.Second)); err != errCircuitOpen {
+		t.Fatalf("allow during cooldown = %v, want %v", err, errCircuitOpen)
+	}
+
+	// The trial call after the cooldown fails and reopens the circuit
+	if err := b.allow(start.Add(10 * time.Second)); err != nil {
+		t.Fatalf("trial call: %v", err)
+	}
+	if b.state != circuitHalfOpen {
+		t.Fatalf("state = %v, want half-open", b.state)
+	}
+	b.record(failure, start.Add(10*time.Second))
+	if err := b.allow(start.Add(15 * time.Second)); err != errCircuitOpen {
+		t.Fatalf("allow after failed trial = %v, want %v", err, errCircuitOpen)
+	}
+
+	// The endpoint recovers
+	if err := b.allow(start.Add(20 * time.Second)); err != nil {
+		t.Fatalf("second trial call: %v", err)
+	}
+	b.record(nil, start.Add(20*time.Second))
+	if b.state != circuitClosed || b.failures != 0 {
+		t.Fatalf("state = %v with %d failures, want closed with none", b.state, b.failures)
+	}
+	b.record(failure, start.Add(21*time.Second))
+	if err := b.allow(start.Add(21 * time.Second)); err != nil {
+		t.Fatalf("allow after a single failure: %v", err)
+	}
+}
+
+func TestCircuitBreakerSnapshot(t *testing.T) {
+	openedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(1, time.Minute)
+	b.record(errors.New("timeout"), openedAt)
+
+	restored := newCircuitBreaker(1, time.Minute)
+	restored.restore(b.snapshot())
+	if err := restored.allow(openedAt.Add(time.Second)); err != errCircuitOpen {
+		t.Fatalf("restored breaker allow = %v, want %v", err, errCircuitOpen)
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"golem/template/clock"
+	"time"
+)
+
+// TTL is a size-bounded in-memory cache whose entries expire a fixed time
+// after they are set. Expired entries are dropped lazily when they are
+// looked up, or when room is needed for a new entry.
+type TTL[K comparable, V any] struct {
+	// Now returns the current time, clock.Now if nil
+	Now func() time.Time
+
+	ttl     time.Duration
+	maxSize int
+	entries map[K]entry[V]
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a cache keeping each entry for ttl and at most maxSize
+// entries at a time
+func New[K comparable, V any](ttl time.Duration, maxSize int) *TTL[K, V] {
+	return &TTL[K, V]{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: map[K]entry[V]{},
+	}
+}
+
+// Get returns the value set for key, if it has not expired yet
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value for key. When the cache is full, expired entries are
+// dropped first, then the entry closest to expiry.
+func (c *TTL[K, V]) Set(key K, value V) {
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxSize {
+		c.evict(now)
+	}
+	c.entries[key] = entry[V]{
+		value:     value,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+func (c *TTL[K, V]) evict(now time.Time) {
+	var oldestKey K
+	var oldest time.Time
+	found := false
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if !found || e.expiresAt.Before(oldest) {
+			oldestKey, oldest, found = key, e.expiresAt, true
+		}
+	}
+	if found && len(c.entries) >= c.maxSize {
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *TTL[K, V]) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return clock.Now()
+}
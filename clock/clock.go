@@ -0,0 +1,20 @@
+// Package clock reads the time from the wasi:clocks wall clock of the host.
+// Golem records each reading in the oplog and hands the recorded time back
+// when the worker is replayed, so timestamps taken with Now are the same in
+// a replay as in the original run.
+package clock
+
+import (
+	"time"
+)
+
+// wallClock returns the seconds and nanoseconds since the Unix epoch of the
+// host's wall clock, time.Now outside of a WASI host. Tests replace it.
+var wallClock = hostWallClock
+
+// Now returns the current time of the host's durable wall clock. Use it
+// instead of time.Now for timestamps that are part of the worker state.
+func Now() time.Time {
+	seconds, nanoseconds := wallClock()
+	return time.Unix(int64(seconds), int64(nanoseconds))
+}
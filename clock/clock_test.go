@@ -0,0 +1,31 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func fixedWallClock(t *testing.T, seconds uint64, nanoseconds uint32) {
+	previous := wallClock
+	wallClock = func() (uint64, uint32) { return seconds, nanoseconds }
+	t.Cleanup(func() { wallClock = previous })
+}
+
+func TestNow(t *testing.T) {
+	tests := []struct {
+		seconds     uint64
+		nanoseconds uint32
+		want        time.Time
+	}{
+		{0, 0, time.Unix(0, 0)},
+		{1767225600, 0, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{1767225600, 999999999, time.Date(2026, 1, 1, 0, 0, 0, 999999999, time.UTC)},
+		{1767225600, 1500000000, time.Date(2026, 1, 1, 0, 0, 1, 500000000, time.UTC)},
+	}
+	for _, test := range tests {
+		fixedWallClock(t, test.seconds, test.nanoseconds)
+		if got := Now(); !got.Equal(test.want) {
+			t.Errorf("Now() at %d.%09d = %v, want %v", test.seconds, test.nanoseconds, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build tinygo.wasm
+
+package clock
+
+import (
+	golem "golem/template/gogolem_test"
+)
+
+func hostWallClock() (uint64, uint32) {
+	now := golem.WasiClocksWallClockNow()
+	return now.Seconds, now.Nanoseconds
+}
@@ -0,0 +1,12 @@
+//go:build !tinygo.wasm
+
+package clock
+
+import (
+	"time"
+)
+
+func hostWallClock() (uint64, uint32) {
+	now := time.Now()
+	return uint64(now.Unix()), uint32(now.Nanosecond())
+}
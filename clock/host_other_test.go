@@ -0,0 +1,16 @@
+//go:build !tinygo.wasm
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNowOutsideWasiHost(t *testing.T) {
+	before := time.Now().Truncate(time.Second)
+	now := Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("Now() = %v, want about %v", now, before)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"golem/template/roundtrip"
+	"mime"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the configuration of the worker, read from its environment by
+// Configure:
+//
+//	PUBLISH_URL               where totals are published, defaults to defaultPublishUrl
+//	PUBLISH_ENCODING          json (the default) or proto
+//	PUBLISH_CONTENT_TYPE      content type of JSON payloads, application/json if unset
+//	PUBLISH_MAX_RETRIES       retries of requests answered with 429 or 503, none if unset
+//	PUBLISH_RETRY_BASE_DELAY  delay before the first retry, such as 500ms
+//	PUBLISH_RETRY_MAX_DELAY   cap of the retry delays, such as 30s
+//	PUBLISH_CACHE_TTL         how long a published total's reply is reused, such as 10s
+//	PUBLISH_GZIP              true to gzip publish and flush bodies of roundtrip.MinGzipSize bytes or more
+//	STRICT_DECODING           true to reject unknown fields and trailing data in replies
+//	DEBUG                     true to log publish requests and responses
+//	HISTORY_SIZE              number of operations History keeps, defaultHistorySize if unset
+//	INITIAL_TOTAL             total the counter starts from, 0 if unset
+type Config struct {
+	PublishUrl      string
+	Encoder         Encoder
+	RetryPolicy     *roundtrip.RetryPolicy
+	PublishCacheTTL time.Duration
+	PublishGzip     bool
+	StrictDecoding  bool
+	Debug           bool
+	HistorySize     int
+	// InitialTotal is nil if INITIAL_TOTAL is unset
+	InitialTotal *uint64
+}
+
+// Configure reads the configuration from the environment, failing with a
+// description of the first variable that is malformed
+func Configure() (Config, error) {
+	config := Config{
+		PublishUrl:  defaultPublishUrl,
+		HistorySize: defaultHistorySize,
+	}
+
+	if target := os.Getenv("PUBLISH_URL"); target != "" {
+		if err := validatePublishUrl(target); err != nil {
+			return config, fmt.Errorf("Invalid PUBLISH_URL: %v", err)
+		}
+		config.PublishUrl = target
+	}
+
+	contentType := os.Getenv("PUBLISH_CONTENT_TYPE")
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return config, fmt.Errorf("Invalid PUBLISH_CONTENT_TYPE %q: %v", contentType, err)
+		}
+	}
+	switch encoding := os.Getenv("PUBLISH_ENCODING"); encoding {
+	case "", "json":
+		config.Encoder = JSONEncoder{
+			ContentType: contentType,
+		}
+	case "proto", "protobuf":
+		config.Encoder = ProtoEncoder{}
+	default:
+		return config, fmt.Errorf("Invalid PUBLISH_ENCODING %q: expected json or proto", encoding)
+	}
+
+	if value := os.Getenv("PUBLISH_MAX_RETRIES"); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil || maxRetries < 0 {
+			return config, fmt.Errorf("Invalid PUBLISH_MAX_RETRIES %q: expected a number of retries", value)
+		}
+		baseDelay, err := durationEnv("PUBLISH_RETRY_BASE_DELAY")
+		if err != nil {
+			return config, err
+		}
+		maxDelay, err := durationEnv("PUBLISH_RETRY_MAX_DELAY")
+		if err != nil {
+			return config, err
+		}
+		config.RetryPolicy = &roundtrip.RetryPolicy{
+			MaxRetries: maxRetries,
+			BaseDelay:  baseDelay,
+			MaxDelay:   maxDelay,
+		}
+	}
+
+	var err error
+	if config.PublishCacheTTL, err = durationEnv("PUBLISH_CACHE_TTL"); err != nil {
+		return config, err
+	}
+	if config.PublishGzip, err = boolEnv("PUBLISH_GZIP"); err != nil {
+		return config, err
+	}
+	if config.StrictDecoding, err = boolEnv("STRICT_DECODING"); err != nil {
+		return config, err
+	}
+	if config.Debug, err = boolEnv("DEBUG"); err != nil {
+		return config, err
+	}
+
+	if value := os.Getenv("HISTORY_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return config, fmt.Errorf("Invalid HISTORY_SIZE %q: expected a number of operations", value)
+		}
+		config.HistorySize = size
+	}
+
+	if value := os.Getenv("INITIAL_TOTAL"); value != "" {
+		initialTotal, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return config, fmt.Errorf("Invalid INITIAL_TOTAL %q: expected a non-negative integer", value)
+		}
+		config.InitialTotal = &initialTotal
+	}
+
+	return config, nil
+}
+
+// durationEnv parses the duration in the environment variable name, zero if
+// it is unset
+func durationEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid %s %q: expected a duration such as 500ms", name, value)
+	}
+	return d, nil
+}
+
+// boolEnv parses the boolean in the environment variable name, false if it
+// is unset
+func boolEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s %q: expected true or false", name, value)
+	}
+	return b, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"golem/template/roundtrip"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var configEnv = []string{
+	"PUBLISH_URL",
+	"PUBLISH_ENCODING",
+	"PUBLISH_CONTENT_TYPE",
+	"PUBLISH_MAX_RETRIES",
+	"PUBLISH_RETRY_BASE_DELAY",
+	"PUBLISH_RETRY_MAX_DELAY",
+	"PUBLISH_CACHE_TTL",
+	"PUBLISH_GZIP",
+	"STRICT_DECODING",
+	"DEBUG",
+	"HISTORY_SIZE",
+	"INITIAL_TOTAL",
+}
+
+// setConfigEnv clears the configuration variables, then sets env
+func setConfigEnv(t *testing.T, env map[string]string) {
+	for _, name := range configEnv {
+		t.Setenv(name, "")
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+func TestConfigureDefaults(t *testing.T) {
+	setConfigEnv(t, nil)
+	config, err := Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PublishUrl != defaultPublishUrl {
+		t.Errorf("PublishUrl = %q, want %q", config.PublishUrl, defaultPublishUrl)
+	}
+	if config.HistorySize != defaultHistorySize {
+		t.Errorf("HistorySize = %d, want %d", config.HistorySize, defaultHistorySize)
+	}
+	if config.RetryPolicy != nil || config.InitialTotal != nil {
+		t.Errorf("RetryPolicy = %v, InitialTotal = %v, want nil", config.RetryPolicy, config.InitialTotal)
+	}
+	if config.PublishCacheTTL != 0 || config.PublishGzip || config.StrictDecoding || config.Debug {
+		t.Errorf("config = %+v, want everything off", config)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	setConfigEnv(t, map[string]string{
+		"PUBLISH_URL":              "https://counter.example.com/totals",
+		"PUBLISH_CONTENT_TYPE":     "application/vnd.myorg.counter+json",
+		"PUBLISH_MAX_RETRIES":      "3",
+		"PUBLISH_RETRY_BASE_DELAY": "250ms",
+		"PUBLISH_RETRY_MAX_DELAY":  "5s",
+		"PUBLISH_CACHE_TTL":        "10s",
+		"PUBLISH_GZIP":             "true",
+		"STRICT_DECODING":          "1",
+		"DEBUG":                    "true",
+		"HISTORY_SIZE":             "0",
+		"INITIAL_TOTAL":            "0",
+	})
+	config, err := Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PublishUrl != "https://counter.example.com/totals" {
+		t.Errorf("PublishUrl = %q", config.PublishUrl)
+	}
+	if encoder, ok := config.Encoder.(JSONEncoder); !ok || encoder.ContentType != "application/vnd.myorg.counter+json" {
+		t.Errorf("Encoder = %#v, want JSON with the vendor content type", config.Encoder)
+	}
+	want := roundtrip.RetryPolicy{MaxRetries: 3, BaseDelay: 250 * time.Millisecond, MaxDelay: 5 * time.Second}
+	if config.RetryPolicy == nil || *config.RetryPolicy != want {
+		t.Errorf("RetryPolicy = %+v, want %+v", config.RetryPolicy, want)
+	}
+	if config.PublishCacheTTL != 10*time.Second {
+		t.Errorf("PublishCacheTTL = %v, want 10s", config.PublishCacheTTL)
+	}
+	if !config.PublishGzip || !config.StrictDecoding || !config.Debug {
+		t.Errorf("config = %+v, want gzip, strict decoding and debug on", config)
+	}
+	if config.HistorySize != 0 {
+		t.Errorf("HistorySize = %d, want 0", config.HistorySize)
+	}
+	if config.InitialTotal == nil || *config.InitialTotal != 0 {
+		t.Errorf("InitialTotal = %v, want 0", config.InitialTotal)
+	}
+}
+
+func TestConfigureEncoding(t *testing.T) {
+	for _, encoding := range []string{"", "json", "proto", "protobuf"} {
+		setConfigEnv(t, map[string]string{"PUBLISH_ENCODING": encoding})
+		config, err := Configure()
+		if err != nil {
+			t.Fatalf("PUBLISH_ENCODING=%q: %v", encoding, err)
+		}
+		_, proto := config.Encoder.(ProtoEncoder)
+		if proto != strings.HasPrefix(encoding, "proto") {
+			t.Errorf("PUBLISH_ENCODING=%q gives %#v", encoding, config.Encoder)
+		}
+	}
+}
+
+func TestConfigureRetryDelaysNeedRetries(t *testing.T) {
+	setConfigEnv(t, map[string]string{"PUBLISH_RETRY_BASE_DELAY": "1s"})
+	config, err := Configure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RetryPolicy != nil {
+		t.Errorf("RetryPolicy = %+v without PUBLISH_MAX_RETRIES, want nil", config.RetryPolicy)
+	}
+}
+
+func TestConfigureMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"PUBLISH_URL", "localhost:9999"},
+		{"PUBLISH_URL", "ftp://counter.example.com/"},
+		{"PUBLISH_URL", "http:///totals"},
+		{"PUBLISH_ENCODING", "xml"},
+		{"PUBLISH_CONTENT_TYPE", "application/json; charset"},
+		{"PUBLISH_MAX_RETRIES", "three"},
+		{"PUBLISH_MAX_RETRIES", "-1"},
+		{"PUBLISH_CACHE_TTL", "10"},
+		{"PUBLISH_CACHE_TTL", "-1s"},
+		{"PUBLISH_GZIP", "yes"},
+		{"STRICT_DECODING", "on"},
+		{"DEBUG", "verbose"},
+		{"HISTORY_SIZE", "many"},
+		{"HISTORY_SIZE", "-1"},
+		{"PUBLISH_RETRY_BASE_DELAY", "500"},
+		{"PUBLISH_RETRY_BASE_DELAY", "-1s"},
+		{"PUBLISH_RETRY_MAX_DELAY", "soon"},
+		{"INITIAL_TOTAL", "-5"},
+		{"INITIAL_TOTAL", "18446744073709551616"},
+	}
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+			setConfigEnv(t, map[string]string{test.name: test.value})
+			if strings.HasPrefix(test.name, "PUBLISH_RETRY_") {
+				t.Setenv("PUBLISH_MAX_RETRIES", "3")
+			}
+			_, err := Configure()
+			if err == nil {
+				t.Fatal("Configure succeeded")
+			}
+			if !strings.Contains(err.Error(), test.name) {
+				t.Errorf("error %q does not name %s", err, test.name)
+			}
+		})
+	}
+}
+
+func TestNewGogolemTestImplStartsFromInitialTotal(t *testing.T) {
+	resetState(t)
+	initialTotal := uint64(0)
+	e := newGogolemTestImpl(Config{InitialTotal: &initialTotal}, nil)
+
+	if got, ok := e.getChecked(); !ok || got != 0 {
+		t.Errorf("getChecked = %d, %v, want a set total of 0", got, ok)
+	}
+}
+
+func TestNewGogolemTestImplKeepsConfigError(t *testing.T) {
+	resetState(t)
+	configErr := errors.New(`Invalid PUBLISH_ENCODING "xml": expected json or proto`)
+	initialTotal := uint64(5)
+	transport := &roundtrip.MockTransport{}
+	e := newGogolemTestImpl(Config{InitialTotal: &initialTotal}, configErr)
+	e.Client = &http.Client{Transport: transport}
+
+	if _, ok := e.getChecked(); ok {
+		t.Error("the initial total of a failed configuration was applied")
+	}
+	e.Add(1)
+	for name, call := range map[string]func() error{
+		"publish":     func() error { _, err := e.publish(); return err },
+		"flush":       e.flush,
+		"health":      e.health,
+		"healthCheck": e.healthCheck,
+	} {
+		if err := call(); !errors.Is(err, configErr) {
+			t.Errorf("%s = %v, want the configuration error", name, err)
+		}
+	}
+	if requests := transport.Requests(); len(requests) != 0 {
+		t.Errorf("sent %d requests with a failed configuration", len(requests))
+	}
+}
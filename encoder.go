@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const bodySnippetLength = 200
+
+// Encoder serializes a publish payload and reports the content type the
+// server should use to decode it
+type Encoder interface {
+	Marshal(v any) ([]byte, string, error)
+}
+
+type JSONEncoder struct {
+	// ContentType is sent instead of application/json when set, for
+	// services expecting a vendor media type such as
+	// application/vnd.myorg.counter+json
+	ContentType string
+}
+
+func (e JSONEncoder) Marshal(v any) ([]byte, string, error) {
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	data, err := json.Marshal(v)
+	return data, contentType, err
+}
+
+// ProtoEncoder encodes RequestBody and FlushRequestBody using the protobuf
+// wire format of
+//
+//	message RequestBody {
+//	  uint64 current_total = 1;
+//	}
+//
+//	message FlushRequestBody {
+//	  uint64 deltas = 1;
+//	}
+type ProtoEncoder struct{}
+
+func (e ProtoEncoder) Marshal(v any) ([]byte, string, error) {
+	switch body := v.(type) {
+	case RequestBody:
+		return marshalUint64Field(body.CurrentTotal), "application/x-protobuf", nil
+	case *RequestBody:
+		return marshalUint64Field(body.CurrentTotal), "application/x-protobuf", nil
+	case FlushRequestBody:
+		return marshalUint64Field(body.Deltas), "application/x-protobuf", nil
+	case *FlushRequestBody:
+		return marshalUint64Field(body.Deltas), "application/x-protobuf", nil
+	default:
+		return nil, "", fmt.Errorf("protobuf encoding is not supported for %T", v)
+	}
+}
+
+// marshalUint64Field encodes a message whose only field is uint64 field 1
+func marshalUint64Field(value uint64) []byte {
+	// field 1, wire type 0 (varint)
+	data := []byte{1<<3 | 0}
+	return binary.AppendUvarint(data, value)
+}
+
+// decodeJSON decodes an untrusted JSON document into v. A uint64 field is
+// decoded exactly, and a number that is negative, fractional or past
+// math.MaxUint64 is an error rather than a rounded count. Numbers decoded
+// into an interface value are kept as json.Number instead of float64, for
+// the same reason.
+//
+// In strict mode, fields v does not know about and data trailing the JSON
+// value are errors too, which catches drift between the server's schema and
+// ours.
+func decodeJSON(r io.Reader, v any, strict bool) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("body does not match %T: %w", v, err)
+	}
+	if strict && decoder.More() {
+		return fmt.Errorf("body does not match %T: unexpected data after the JSON value", v)
+	}
+	return nil
+}
+
+// isJSONMediaType reports whether contentType is application/json or a
+// structured syntax JSON type like application/vnd.myorg.counter+json
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// checkJSONContentType makes sure a response declares a JSON body before it
+// is decoded, so a mismatched endpoint is reported with what it actually
+// returned instead of a cryptic decoding error
+func checkJSONContentType(contentType string, body []byte) error {
+	if isJSONMediaType(contentType) {
+		return nil
+	}
+
+	snippet := body
+	if len(snippet) > bodySnippetLength {
+		snippet = snippet[:bodySnippetLength]
+	}
+	return fmt.Errorf("expected a JSON response but got content type %q: %q", contentType, snippet)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONMaxUint64(t *testing.T) {
+	for _, value := range []uint64{math.MaxUint64, math.MaxUint64 - 1, 1<<53 + 1} {
+		data, err := json.Marshal(AddRequestBody{Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var request AddRequestBody
+		if err := decodeJSON(strings.NewReader(string(data)), &request, true); err != nil {
+			t.Fatalf("decodeJSON(%s): %v", data, err)
+		}
+		if request.Value != value {
+			t.Errorf("decodeJSON(%s) = %d, want %d", data, request.Value, value)
+		}
+	}
+}
+
+func TestDecodeJSONRejectsNonUint64(t *testing.T) {
+	for _, body := range []string{
+		`{"Value":18446744073709551616}`,
+		`{"Value":-1}`,
+		`{"Value":1.5}`,
+		`{"Value":"1"}`,
+	} {
+		var request AddRequestBody
+		if err := decodeJSON(strings.NewReader(body), &request, false); err == nil {
+			t.Errorf("decodeJSON(%s) = %d, want an error", body, request.Value)
+		}
+	}
+}
+
+func TestDecodeJSONKeepsNumbers(t *testing.T) {
+	var v map[string]any
+	if err := decodeJSON(strings.NewReader(`{"Total":18446744073709551615}`), &v, false); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := v["Total"].(json.Number); !ok || n.String() != "18446744073709551615" {
+		t.Errorf("Total = %#v, want json.Number 18446744073709551615", v["Total"])
+	}
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	for _, body := range []string{`{"Message":"ok","Extra":1}`, `{"Message":"ok"} {}`} {
+		var response ResponseBody
+		if err := decodeJSON(strings.NewReader(body), &response, false); err != nil {
+			t.Errorf("decodeJSON(%s) lenient: %v", body, err)
+		}
+		if err := decodeJSON(strings.NewReader(body), &response, true); err == nil {
+			t.Errorf("decodeJSON(%s) strict succeeded", body)
+		}
+	}
+}
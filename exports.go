@@ -0,0 +1,201 @@
+//go:build tinygo.wasm
+
+package main
+
+import (
+	"fmt"
+	"golem/template/gogolem_test"
+	"golem/template/incoming"
+	"golem/template/promise"
+	"net/http"
+	"time"
+)
+
+func init() {
+	a := newGogolemTestImpl(Configure())
+	gogolem_test.SetExportsGolemTemplateApi(a)
+	gogolem_test.SetExportsWasiHttpIncomingHandler(incoming.Handler{
+		Handler: newCounterHandler(a),
+	})
+}
+
+// unitResult is the result of a call that returns nothing but can fail
+func unitResult(err error) gogolem_test.Result[struct{}, string] {
+	var result gogolem_test.Result[struct{}, string]
+	if err != nil {
+		result.SetErr(err.Error())
+		return result
+	}
+	result.Set(struct{}{})
+	return result
+}
+
+// responseBodyResult is the result of a call returning a decoded response
+func responseBodyResult(body ResponseBody, err error) gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiResponseBody, string] {
+	var result gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiResponseBody, string]
+	if err != nil {
+		result.SetErr(err.Error())
+		return result
+	}
+	result.Set(gogolem_test.ExportsGolemTemplateApiResponseBody{
+		Message: body.Message,
+	})
+	return result
+}
+
+// GetChecked returns the total like Get, or none if nothing was ever added
+// to it. A total that was reset after an addition is still returned.
+func (e GogolemTestImpl) GetChecked() gogolem_test.Option[uint64] {
+	value, ok := e.getChecked()
+	if !ok {
+		return gogolem_test.None[uint64]()
+	}
+	return gogolem_test.Some[uint64](value)
+}
+
+// GetAsync returns a promise which is completed with the total at the time
+// of the call, and which the caller deletes, see getAsync
+func (e GogolemTestImpl) GetAsync() gogolem_test.GolemApiHostPromiseId {
+	return e.getAsync().HostId()
+}
+
+// Publish publishes the total to the default publish URL. Besides the
+// message, the result carries the X-Request-Id the server answered with, to
+// correlate the call with the server's logs, and the status: 200 when the
+// total was processed, 202 when it was only accepted for processing. A
+// failure tells whether the
+// request got no response, got a non-2xx status or could not be decoded.
+func (e GogolemTestImpl) Publish() gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiPublishOk, gogolem_test.ExportsGolemTemplateApiPublishError] {
+	reply, err := e.publish()
+	if err == nil {
+		fmt.Println(reply.body.Message)
+	}
+	return publishResult(reply, err)
+}
+
+// PublishWithTimeout publishes like Publish, but fails if the server does
+// not answer within timeoutMs milliseconds
+func (e GogolemTestImpl) PublishWithTimeout(timeoutMs uint64) gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiPublishOk, gogolem_test.ExportsGolemTemplateApiPublishError] {
+	return publishResult(e.publishWithTimeout(time.Duration(timeoutMs) * time.Millisecond))
+}
+
+func publishResult(reply publishReply, err error) gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiPublishOk, gogolem_test.ExportsGolemTemplateApiPublishError] {
+	var result gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiPublishOk, gogolem_test.ExportsGolemTemplateApiPublishError]
+	if err != nil {
+		result.SetErr(asPublishError(err).toWit())
+		return result
+	}
+
+	requestId := gogolem_test.None[string]()
+	if id := reply.header.Get("X-Request-Id"); id != "" {
+		requestId = gogolem_test.Some[string](id)
+	}
+	result.Set(gogolem_test.ExportsGolemTemplateApiPublishOk{
+		Message:   reply.body.Message,
+		RequestId: requestId,
+		Status:    uint16(reply.status),
+		Accepted:  reply.status == http.StatusAccepted,
+	})
+	return result
+}
+
+// toWit converts the error to the publish-error variant of the api
+func (e *PublishError) toWit() gogolem_test.ExportsGolemTemplateApiPublishError {
+	kind, code, message := e.witCase()
+	switch kind {
+	case PublishErrorStatus:
+		return gogolem_test.ExportsGolemTemplateApiPublishErrorStatus(code)
+	case PublishErrorDecode:
+		return gogolem_test.ExportsGolemTemplateApiPublishErrorDecode(message)
+	default:
+		return gogolem_test.ExportsGolemTemplateApiPublishErrorNetwork(message)
+	}
+}
+
+// PublishTo publishes the total to target instead of the default publish
+// URL and returns the decoded response
+func (e GogolemTestImpl) PublishTo(target string) gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiResponseBody, string] {
+	return responseBodyResult(e.publishToTarget(target))
+}
+
+// AddAndPublish adds value to the total and publishes the new total. The
+// addition is kept even if publishing fails.
+func (e GogolemTestImpl) AddAndPublish(value uint64) gogolem_test.Result[gogolem_test.ExportsGolemTemplateApiResponseBody, string] {
+	return responseBodyResult(e.addAndPublish(value))
+}
+
+// LastPublishStatus tells whether the most recent Publish or
+// PublishWithTimeout succeeded, and when, without publishing again
+func (e GogolemTestImpl) LastPublishStatus() gogolem_test.ExportsGolemTemplateApiPublishStatus {
+	if !lastPublish.published {
+		return gogolem_test.ExportsGolemTemplateApiPublishStatusNeverPublished()
+	}
+
+	at := uint64(lastPublish.at.UnixMilli())
+	if lastPublish.err != nil {
+		return gogolem_test.ExportsGolemTemplateApiPublishStatusFailed(gogolem_test.ExportsGolemTemplateApiPublishFailure{
+			AtMs:  at,
+			Error: lastPublish.err.Error(),
+		})
+	}
+	return gogolem_test.ExportsGolemTemplateApiPublishStatusSucceeded(at)
+}
+
+// History returns the most recent operations on the total, oldest first
+func (e GogolemTestImpl) History() []gogolem_test.ExportsGolemTemplateApiOperation {
+	operations := make([]gogolem_test.ExportsGolemTemplateApiOperation, 0, len(history))
+	for _, op := range history {
+		kind := gogolem_test.ExportsGolemTemplateApiOperationKindAdd()
+		if op.kind == operationReset {
+			kind = gogolem_test.ExportsGolemTemplateApiOperationKindReset()
+		}
+		operations = append(operations, gogolem_test.ExportsGolemTemplateApiOperation{
+			Kind:  kind,
+			Value: op.value,
+			AtMs:  uint64(op.at.UnixMilli()),
+			Total: op.total,
+		})
+	}
+	return operations
+}
+
+// LoadSnapshot restores the counter state from a snapshot of this or an
+// earlier version, see loadSnapshot
+func (e GogolemTestImpl) LoadSnapshot(snapshot []byte) gogolem_test.Result[struct{}, string] {
+	return unitResult(e.loadSnapshot(snapshot))
+}
+
+// StreamPublish adds the values and streams the totals, see streamPublish
+func (e GogolemTestImpl) StreamPublish(values []uint64) gogolem_test.Result[struct{}, string] {
+	return unitResult(e.streamPublish(values))
+}
+
+// Flush sends the accumulated deltas in a single POST, see flush. Hosts
+// can call it before suspending a worker.
+func (e GogolemTestImpl) Flush() gogolem_test.Result[struct{}, string] {
+	return unitResult(e.flush())
+}
+
+// Shutdown flushes the pending deltas before the worker is suspended or
+// updated, see shutdown
+func (e GogolemTestImpl) Shutdown() gogolem_test.Result[struct{}, string] {
+	return unitResult(e.shutdown())
+}
+
+// HealthCheck pings the /health path of the publish endpoint without
+// touching the counter state
+func (e GogolemTestImpl) HealthCheck() gogolem_test.Result[struct{}, string] {
+	return unitResult(e.healthCheck())
+}
+
+// Health checks that the publish endpoint answers a HEAD request, see health
+func (e GogolemTestImpl) Health() gogolem_test.Result[struct{}, string] {
+	return unitResult(e.health())
+}
+
+// Pause blocks until the promise it prints is completed externally
+func (e GogolemTestImpl) Pause() {
+	p := promise.New[struct{}](e.Promises)
+	fmt.Println("Waiting for promise", p.Id)
+	p.Await()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// newCounterHandler serves the counter over HTTP: GET /total returns the
+// total and POST /add adds the posted value to it
+func newCounterHandler(a GogolemTestImpl) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/total", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TotalResponseBody{
+			Total: a.Get(),
+		})
+	})
+	mux.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var request AddRequestBody
+		if err := decodeJSON(r.Body, &request, false); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.Add(request.Value)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterHandlerAddMaxUint64(t *testing.T) {
+	fixedClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	resetState(t)
+	handler := newCounterHandler(GogolemTestImpl{})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(`{"Value":18446744073709551615}`)))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("POST /add = %d %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/total", nil))
+	if body := strings.TrimSpace(recorder.Body.String()); body != `{"Total":18446744073709551615}` {
+		t.Errorf("GET /total = %s, want %d", body, uint64(math.MaxUint64))
+	}
+}
+
+func TestCounterHandlerAddRejectsOverflow(t *testing.T) {
+	resetState(t)
+	handler := newCounterHandler(GogolemTestImpl{})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(`{"Value":18446744073709551616}`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("POST /add = %d, want 400", recorder.Code)
+	}
+	if total != 0 {
+		t.Errorf("total = %d after a rejected add", total)
+	}
+}
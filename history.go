@@ -0,0 +1,42 @@
+package main
+
+import (
+	"time"
+)
+
+// defaultHistorySize is the number of operations History keeps when
+// HISTORY_SIZE is not set
+const defaultHistorySize = 100
+
+type operationKind int
+
+const (
+	operationAdd operationKind = iota
+	operationReset
+)
+
+// operation is a change of the total
+type operation struct {
+	kind operationKind
+	// value is the amount added, or the total that was reset
+	value uint64
+	at    time.Time
+	total uint64
+}
+
+// history holds the most recent operations, oldest first
+var history []operation
+
+// recordOperation appends an operation that left the total at its current
+// value, and drops the oldest ones past size
+func recordOperation(kind operationKind, value uint64, size int) {
+	history = append(history, operation{
+		kind:  kind,
+		value: value,
+		at:    now(),
+		total: total,
+	})
+	if len(history) > size {
+		history = append(history[:0], history[len(history)-size:]...)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordOperationKeepsNewest(t *testing.T) {
+	resetState(t)
+	fixedClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	for value := uint64(1); value <= 5; value++ {
+		total += value
+		recordOperation(operationAdd, value, 3)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("len(history) = %d, want 3", len(history))
+	}
+	for i, want := range []operation{{value: 3, total: 6}, {value: 4, total: 10}, {value: 5, total: 15}} {
+		if got := history[i]; got.value != want.value || got.total != want.total {
+			t.Errorf("history[%d] = %+v, want value %d and total %d", i, got, want.value, want.total)
+		}
+	}
+}
+
+func TestRecordOperationUnderCap(t *testing.T) {
+	resetState(t)
+	recordOperation(operationAdd, 1, 3)
+	recordOperation(operationReset, 1, 3)
+
+	if len(history) != 2 || history[0].kind != operationAdd || history[1].kind != operationReset {
+		t.Errorf("history = %+v, want the add then the reset", history)
+	}
+}
+
+func TestRecordOperationSizeZero(t *testing.T) {
+	resetState(t)
+	recordOperation(operationAdd, 1, 0)
+	recordOperation(operationAdd, 2, 0)
+
+	if len(history) != 0 {
+		t.Errorf("history = %+v, want nothing kept", history)
+	}
+}
@@ -0,0 +1,137 @@
+package incoming
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Handler implements the wasi:http incoming-handler export by translating
+// each incoming request into a http.Request served by a http.Handler
+type Handler struct {
+	Handler http.Handler
+}
+
+// serve answers goRequest with the handler, or with 400 if the incoming
+// request could not be read into one
+func (h Handler) serve(writer *responseWriter, goRequest *http.Request, err error) {
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	} else {
+		defer goRequest.Body.Close()
+		h.Handler.ServeHTTP(writer, goRequest)
+	}
+	writer.finish()
+}
+
+// incomingRequest is an incoming request as handed over by the host
+type incomingRequest struct {
+	method string
+	// pathWithQuery, scheme and authority are empty if the host left them out
+	pathWithQuery string
+	scheme        string
+	authority     string
+	header        http.Header
+	body          io.ReadCloser
+}
+
+func toHttpRequest(request incomingRequest) (*http.Request, error) {
+	target := &url.URL{
+		Scheme: "http",
+		Path:   "/",
+	}
+	if request.pathWithQuery != "" {
+		parsed, err := url.ParseRequestURI(request.pathWithQuery)
+		if err != nil {
+			request.body.Close()
+			return nil, err
+		}
+		target = parsed
+	}
+	if request.scheme != "" {
+		target.Scheme = request.scheme
+	}
+	if request.authority != "" {
+		target.Host = request.authority
+	}
+
+	goRequest, err := http.NewRequest(request.method, target.String(), request.body)
+	if err != nil {
+		request.body.Close()
+		return nil, err
+	}
+	goRequest.RequestURI = target.RequestURI()
+
+	for key, values := range request.header {
+		for _, value := range values {
+			goRequest.Header.Add(key, value)
+		}
+	}
+	if cl := goRequest.Header.Get("Content-Length"); cl != "" {
+		goRequest.ContentLength, _ = strconv.ParseInt(cl, 10, 64)
+	} else {
+		goRequest.ContentLength = -1
+	}
+
+	return goRequest, nil
+}
+
+// responseSink sends a response to the host
+type responseSink interface {
+	// start sends the status and headers and returns where the body goes
+	start(statusCode int, header http.Header) (io.Writer, error)
+	// finish completes the response, bodyErr is the error writing the body
+	// failed with, if any
+	finish(bodyErr error)
+}
+
+// responseWriter is a http.ResponseWriter sending the response through a
+// responseSink. The status and headers are sent on the first write, the
+// body is streamed as it is written.
+type responseWriter struct {
+	sink   responseSink
+	header http.Header
+
+	wroteHeader bool
+	body        io.Writer
+	bodyErr     error
+}
+
+func newResponseWriter(sink responseSink) *responseWriter {
+	return &responseWriter{
+		sink:   sink,
+		header: http.Header{},
+	}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.body, w.bodyErr = w.sink.start(statusCode, w.header)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.bodyErr != nil {
+		return 0, w.bodyErr
+	}
+	n, err := w.body.Write(p)
+	if err != nil {
+		w.bodyErr = err
+	}
+	return n, err
+}
+
+// finish sends an empty 200 response if the handler wrote nothing, then
+// completes the response
+func (w *responseWriter) finish() {
+	w.WriteHeader(http.StatusOK)
+	w.sink.finish(w.bodyErr)
+}
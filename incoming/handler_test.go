@@ -0,0 +1,117 @@
+package incoming
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recordingSink is a responseSink keeping the response in memory
+type recordingSink struct {
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	starts     int
+	finished   bool
+}
+
+func (s *recordingSink) start(statusCode int, header http.Header) (io.Writer, error) {
+	s.starts++
+	s.statusCode = statusCode
+	s.header = header.Clone()
+	return &s.body, nil
+}
+
+func (s *recordingSink) finish(bodyErr error) {
+	s.finished = true
+}
+
+// serveIncoming drives handler with a synthetic incoming request
+func serveIncoming(handler http.Handler, request incomingRequest) *recordingSink {
+	sink := &recordingSink{}
+	goRequest, err := toHttpRequest(request)
+	Handler{Handler: handler}.serve(newResponseWriter(sink), goRequest, err)
+	return sink
+}
+
+func TestHandlerTranslatesRequest(t *testing.T) {
+	var seen *http.Request
+	var seenBody string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		body, _ := ioutil.ReadAll(r.Body)
+		seenBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	sink := serveIncoming(handler, incomingRequest{
+		method:        http.MethodPost,
+		pathWithQuery: "/add?source=test",
+		scheme:        "https",
+		authority:     "counter.internal",
+		header:        http.Header{"Content-Length": {"11"}, "X-Trace": {"abc"}},
+		body:          io.NopCloser(strings.NewReader(`{"Value":3}`)),
+	})
+
+	if seen == nil {
+		t.Fatal("handler was not called")
+	}
+	if seen.Method != http.MethodPost || seen.URL.String() != "https://counter.internal/add?source=test" {
+		t.Errorf("request = %s %s", seen.Method, seen.URL)
+	}
+	if seen.RequestURI != "/add?source=test" || seen.Host != "counter.internal" {
+		t.Errorf("RequestURI = %q, Host = %q", seen.RequestURI, seen.Host)
+	}
+	if seen.Header.Get("X-Trace") != "abc" || seen.ContentLength != 11 || seenBody != `{"Value":3}` {
+		t.Errorf("header = %v, length = %d, body = %q", seen.Header, seen.ContentLength, seenBody)
+	}
+
+	if sink.starts != 1 || sink.statusCode != http.StatusCreated || !sink.finished {
+		t.Errorf("response started %d times with %d, finished = %v", sink.starts, sink.statusCode, sink.finished)
+	}
+	if sink.header.Get("Content-Type") != "application/json" || sink.body.String() != `{"ok":true}` {
+		t.Errorf("response header = %v, body = %q", sink.header, sink.body.String())
+	}
+}
+
+func TestHandlerDefaults(t *testing.T) {
+	var seen *http.Request
+	sink := serveIncoming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	}), incomingRequest{
+		method: http.MethodGet,
+		header: http.Header{},
+		body:   http.NoBody,
+	})
+
+	if seen == nil || seen.URL.String() != "http:///" || seen.ContentLength != -1 {
+		t.Fatalf("request = %+v", seen)
+	}
+	if sink.statusCode != http.StatusOK || sink.body.Len() != 0 || !sink.finished {
+		t.Errorf("response = %d %q, finished = %v, want an empty 200", sink.statusCode, sink.body.String(), sink.finished)
+	}
+}
+
+func TestHandlerRejectsInvalidTarget(t *testing.T) {
+	called := false
+	sink := serveIncoming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), incomingRequest{
+		method:        http.MethodGet,
+		pathWithQuery: "no-slash",
+		header:        http.Header{},
+		body:          http.NoBody,
+	})
+
+	if called {
+		t.Error("handler was called for an invalid target")
+	}
+	if sink.statusCode != http.StatusBadRequest || !sink.finished {
+		t.Errorf("response = %d, finished = %v, want 400", sink.statusCode, sink.finished)
+	}
+}
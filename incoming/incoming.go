@@ -0,0 +1,150 @@
+//go:build tinygo.wasm
+
+package incoming
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	go_wasi_http "golem/template/gogolem_test"
+	"golem/template/roundtrip"
+)
+
+func (h Handler) Handle(request uint32, responseOut uint32) {
+	defer go_wasi_http.WasiHttpTypesDropIncomingRequest(request)
+
+	writer := newResponseWriter(&wasiResponse{
+		responseOut: responseOut,
+	})
+	goRequest, err := readRequest(request)
+	h.serve(writer, goRequest, err)
+}
+
+func readRequest(request uint32) (*http.Request, error) {
+	incoming := incomingRequest{
+		method: methodString(go_wasi_http.WasiHttpTypesIncomingRequestMethod(request)),
+		header: http.Header{},
+	}
+	if pathWithQuery := go_wasi_http.WasiHttpTypesIncomingRequestPathWithQuery(request); pathWithQuery.IsSome() {
+		incoming.pathWithQuery = pathWithQuery.Unwrap()
+	}
+	if scheme := go_wasi_http.WasiHttpTypesIncomingRequestScheme(request); scheme.IsSome() {
+		incoming.scheme = schemeString(scheme.Unwrap())
+	}
+	if authority := go_wasi_http.WasiHttpTypesIncomingRequestAuthority(request); authority.IsSome() {
+		incoming.authority = authority.Unwrap()
+	}
+
+	headers := go_wasi_http.WasiHttpTypesIncomingRequestHeaders(request)
+	defer go_wasi_http.WasiHttpTypesDropFields(headers)
+	for _, tuple := range go_wasi_http.WasiHttpTypesFieldsEntries(headers) {
+		incoming.header.Add(tuple.F0, string(tuple.F1))
+	}
+
+	bodyResult := go_wasi_http.WasiHttpTypesIncomingRequestConsume(request)
+	if bodyResult.IsErr() {
+		return nil, errors.New("Failed to consume request body")
+	}
+	incoming.body = &roundtrip.WasiStreamReader{
+		Handle: bodyResult.Unwrap(),
+	}
+
+	return toHttpRequest(incoming)
+}
+
+func methodString(method go_wasi_http.WasiHttpTypesMethod) string {
+	switch method.Kind() {
+	case go_wasi_http.WasiHttpTypesMethodKindGet:
+		return http.MethodGet
+	case go_wasi_http.WasiHttpTypesMethodKindHead:
+		return http.MethodHead
+	case go_wasi_http.WasiHttpTypesMethodKindPost:
+		return http.MethodPost
+	case go_wasi_http.WasiHttpTypesMethodKindPut:
+		return http.MethodPut
+	case go_wasi_http.WasiHttpTypesMethodKindDelete:
+		return http.MethodDelete
+	case go_wasi_http.WasiHttpTypesMethodKindConnect:
+		return http.MethodConnect
+	case go_wasi_http.WasiHttpTypesMethodKindOptions:
+		return http.MethodOptions
+	case go_wasi_http.WasiHttpTypesMethodKindTrace:
+		return http.MethodTrace
+	case go_wasi_http.WasiHttpTypesMethodKindPatch:
+		return http.MethodPatch
+	default:
+		return method.GetOther()
+	}
+}
+
+func schemeString(scheme go_wasi_http.WasiHttpTypesScheme) string {
+	switch scheme.Kind() {
+	case go_wasi_http.WasiHttpTypesSchemeKindHttp:
+		return "http"
+	case go_wasi_http.WasiHttpTypesSchemeKindHttps:
+		return "https"
+	default:
+		return scheme.GetOther()
+	}
+}
+
+// wasiResponse sends a response through the response-outparam
+type wasiResponse struct {
+	responseOut uint32
+
+	response uint32
+	body     uint32
+	bodyOpen bool
+}
+
+func (r *wasiResponse) start(statusCode int, header http.Header) (io.Writer, error) {
+	var headerKeyValues []go_wasi_http.WasiHttpTypesTuple2StringStringT
+	for key, values := range header {
+		for _, value := range values {
+			headerKeyValues = append(headerKeyValues, go_wasi_http.WasiHttpTypesTuple2StringStringT{
+				F0: key,
+				F1: value,
+			})
+		}
+	}
+	headers := go_wasi_http.WasiHttpTypesNewFields(headerKeyValues)
+	defer go_wasi_http.WasiHttpTypesDropFields(headers)
+
+	r.response = go_wasi_http.WasiHttpTypesNewOutgoingResponse(uint16(statusCode), headers)
+	var outparam go_wasi_http.Result[uint32, go_wasi_http.WasiHttpTypesError]
+	outparam.Set(r.response)
+	go_wasi_http.WasiHttpTypesSetResponseOutparam(r.responseOut, outparam)
+
+	bodyResult := go_wasi_http.WasiHttpTypesOutgoingResponseWrite(r.response)
+	if bodyResult.IsErr() {
+		return nil, errors.New("Failed to start writing response body")
+	}
+	r.body = bodyResult.Unwrap()
+	r.bodyOpen = true
+	return outputStream(r.body), nil
+}
+
+func (r *wasiResponse) finish(bodyErr error) {
+	if r.bodyOpen && bodyErr == nil {
+		go_wasi_http.WasiHttpTypesFinishOutgoingStream(r.body, go_wasi_http.None[uint32]())
+		go_wasi_http.WasiIoStreamsDropOutputStream(r.body)
+	}
+	go_wasi_http.WasiHttpTypesDropOutgoingResponse(r.response)
+}
+
+// outputStream writes to a wasi:io output stream, blocking until each
+// write is taken whole
+type outputStream uint32
+
+func (s outputStream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		result := go_wasi_http.WasiIoStreamsBlockingWrite(uint32(s), p[written:])
+		if result.IsErr() {
+			return written, errors.New("Failed to write response body chunk")
+		}
+		written += int(result.Unwrap().F0)
+	}
+	return written, nil
+}
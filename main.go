@@ -2,11 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"golem/template/gogolem_test"
+	"golem/template/cache"
+	"golem/template/clock"
+	"golem/template/promise"
 	"golem/template/roundtrip"
+	"golem/template/singleflight"
+	"io"
 	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
 
 	"net/http"
 )
@@ -19,66 +27,569 @@ type ResponseBody struct {
 	Message string
 }
 
-func init() {
-	a := GogolemTestImpl{}
-	gogolem_test.SetExportsGolemTemplateApi(a)
+type FlushRequestBody struct {
+	Deltas uint64
+}
+
+type AddRequestBody struct {
+	Value uint64
+}
+
+type TotalResponseBody struct {
+	Total uint64
+}
+
+const defaultPublishUrl = "http://localhost:9999/post-example"
+
+const healthCheckTimeout = 5 * time.Second
+
+const (
+	publishFailureThreshold = 5
+	publishCooldown         = 30 * time.Second
+)
+
+// newGogolemTestImpl returns the implementation for a configuration read
+// by Configure, starting the total from its InitialTotal. A configuration
+// that failed to load is kept with its error, which the calls depending on
+// the configuration return instead of doing their work.
+func newGogolemTestImpl(config Config, configErr error) GogolemTestImpl {
+	if configErr == nil && config.InitialTotal != nil {
+		total = *config.InitialTotal
+		initialized = true
+	}
+	return GogolemTestImpl{
+		publishBreaker: newCircuitBreaker(publishFailureThreshold, publishCooldown),
+		Client: &http.Client{
+			Transport: roundtrip.WasiHttpTransport{
+				RetryPolicy: config.RetryPolicy,
+			},
+		},
+		config:    config,
+		configErr: configErr,
+	}
 }
 
 // total State can be stored in global variables
 var total uint64
 
+// delta accumulates the additions not yet sent by Flush
+var delta uint64
+
+// initialized is set by the first addition to the total
+var initialized bool
+
+// stateMu guards total, delta, initialized and history against the
+// goroutines an invocation may start
+var stateMu sync.Mutex
+
+// now is the clock of the worker state, replaced by tests
+var now = clock.Now
+
 type GogolemTestImpl struct {
 	total uint64
+
+	// publishBreaker stops publishing to an endpoint that keeps failing. It
+	// is shared by the copies of the implementation the methods receive.
+	publishBreaker *circuitBreaker
+
+	// Client sends the outgoing requests. If nil, a client using
+	// roundtrip.WasiHttpTransport is used; tests can set one backed by
+	// roundtrip.MockTransport instead.
+	Client *http.Client
+
+	// Promises holds the promises GetAsync returns. If nil, they are
+	// created on the Golem host; tests can set a promise.MemoryHost instead.
+	Promises promise.Host
+
+	// config is the configuration read by Configure
+	config Config
+	// configErr is the error Configure failed with, if any
+	configErr error
 }
 
-// Implementation of the exported interface
+// defaultClient is used when GogolemTestImpl.Client is nil. Unlike
+// http.DefaultClient it is not shared with other code in the worker.
+var defaultClient = &http.Client{
+	Transport: roundtrip.WasiHttpTransport{},
+}
+
+// httpClient returns the client the implementation sends its requests with
+func (e GogolemTestImpl) httpClient() *http.Client {
+	if e.Client != nil {
+		return e.Client
+	}
+	return defaultClient
+}
+
+// Implementation of the exported interface. The calls returning WIT types
+// are in exports.go, on top of the functions below.
 
 func (e GogolemTestImpl) Add(value uint64) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
 	total += value
+	delta += value
+	initialized = true
+	recordOperation(operationAdd, value, e.config.HistorySize)
 }
 
 func (e GogolemTestImpl) Get() uint64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return total
+}
+
+// getChecked returns the total like Get, and false if nothing was ever
+// added to it. A total that was reset after an addition is still returned.
+func (e GogolemTestImpl) getChecked() (uint64, bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return total, initialized
+}
+
+// GetAndReset returns the total and resets it to zero. The read and the
+// reset happen under stateMu, so no Add can slip in between them. Pending
+// deltas are not affected and are still sent by the next Flush.
+func (e GogolemTestImpl) GetAndReset() uint64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	value := total
+	total = 0
+	recordOperation(operationReset, value, e.config.HistorySize)
+	return value
+}
+
+// EnsureAtLeast raises the total to value if it is lower and returns the
+// resulting total. Calling it again with the same value changes nothing, so
+// retried and replayed calls are safe. The raise counts as a delta for the
+// next Flush.
+func (e GogolemTestImpl) EnsureAtLeast(value uint64) uint64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if value > total {
+		added := value - total
+		delta += added
+		total = value
+		initialized = true
+		recordOperation(operationAdd, added, e.config.HistorySize)
+	}
 	return total
 }
 
+// getAsync returns a promise completed with the total at the time of the
+// call. The promise is not deleted: whoever awaits it through its id owns
+// it and deletes it once it has the value.
+func (e GogolemTestImpl) getAsync() promise.Id {
+	p := promise.New[uint64](e.Promises)
+	p.Complete(e.Get())
+	return p.Id
+}
+
 func (e GogolemTestImpl) Hello(name string) {
 	println(name)
 }
 
-func (e GogolemTestImpl) Publish() gogolem_test.Result[struct{}, string] {
-	http.DefaultClient.Transport = roundtrip.WasiHttpTransport{}
-	var result gogolem_test.Result[struct{}, string]
+// publish publishes the total to the default publish URL for Publish and
+// records the outcome
+func (e GogolemTestImpl) publish() (publishReply, error) {
+	reply, err := e.cachedPublish(context.Background())
+	recordPublish(err)
+	return reply, err
+}
+
+// publishWithTimeout publishes like publish, but fails if the server does
+// not answer within timeout
+func (e GogolemTestImpl) publishWithTimeout(timeout time.Duration) (publishReply, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	postBody, _ := json.Marshal(RequestBody{
+	reply, err := e.publishTo(ctx, e.config.PublishUrl)
+	recordPublish(err)
+	return reply, err
+}
+
+// publishToTarget publishes the total to target instead of the default
+// publish URL and returns the decoded response
+func (e GogolemTestImpl) publishToTarget(target string) (ResponseBody, error) {
+	if err := validatePublishUrl(target); err != nil {
+		return ResponseBody{}, err
+	}
+	reply, err := e.publishTo(context.Background(), target)
+	if err != nil {
+		return ResponseBody{}, err
+	}
+	return reply.body, nil
+}
+
+// addAndPublish adds value to the total and publishes the new total. The
+// addition is kept even if publishing fails.
+func (e GogolemTestImpl) addAndPublish(value uint64) (ResponseBody, error) {
+	e.Add(value)
+
+	reply, err := e.publishTo(context.Background(), e.config.PublishUrl)
+	if err != nil {
+		return ResponseBody{}, fmt.Errorf("added %d, total is now %d, but publishing failed: %w", value, total, err)
+	}
+	return reply.body, nil
+}
+
+func validatePublishUrl(target string) error {
+	parsed, err := url.ParseRequestURI(target)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid publish url %q: scheme must be http or https", target)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid publish url %q: missing host", target)
+	}
+	return nil
+}
+
+// publishFlights coalesces publishes of the same payload to the same URL
+// that overlap within an invocation into a single request
+var publishFlights singleflight.Group[publishOutcome]
+
+type publishOutcome struct {
+	reply publishReply
+	err   error
+}
+
+// publishReply is a 2xx answer of the publish endpoint
+type publishReply struct {
+	body   ResponseBody
+	status int
+	header http.Header
+}
+
+// publishCache holds the replies to recently published totals
+var publishCache *cache.TTL[uint64, publishReply]
+
+const publishCacheSize = 16
+
+// cachedPublish publishes the total to the default publish URL, unless the
+// same total was published less than PublishCacheTTL ago, in which case the
+// reply received then is reused. Without PublishCacheTTL every call
+// publishes.
+func (e GogolemTestImpl) cachedPublish(ctx context.Context) (publishReply, error) {
+	ttl := e.config.PublishCacheTTL
+	if ttl <= 0 {
+		return e.publishTo(ctx, e.config.PublishUrl)
+	}
+	if publishCache == nil {
+		publishCache = cache.New[uint64, publishReply](ttl, publishCacheSize)
+	}
+
+	if reply, ok := publishCache.Get(total); ok {
+		return reply, nil
+	}
+	reply, err := e.publishTo(ctx, e.config.PublishUrl)
+	if err == nil {
+		publishCache.Set(total, reply)
+	}
+	return reply, err
+}
+
+// publishTo publishes the total to target. Only publishes to the configured
+// publish URL go through publishBreaker, so failing ad-hoc targets passed
+// to PublishTo cannot open the circuit for it.
+func (e GogolemTestImpl) publishTo(ctx context.Context, target string) (publishReply, error) {
+	if e.configErr != nil {
+		return publishReply{}, e.configErr
+	}
+	if target != e.config.PublishUrl {
+		return e.sendPublish(ctx, target)
+	}
+	if err := e.publishBreaker.allow(now()); err != nil {
+		return publishReply{}, err
+	}
+	reply, err := e.sendPublish(ctx, target)
+	e.publishBreaker.record(err, now())
+	return reply, err
+}
+
+func (e GogolemTestImpl) sendPublish(ctx context.Context, target string) (publishReply, error) {
+	postBody, contentType, err := e.config.Encoder.Marshal(RequestBody{
 		CurrentTotal: total,
 	})
-	resp, err := http.Post("http://localhost:9999/post-example", "application/json", bytes.NewBuffer(postBody))
 	if err != nil {
-		result.SetErr(fmt.Sprintln(err))
-		return result
+		return publishReply{}, err
+	}
+
+	key := target + "\n" + contentType + "\n" + string(postBody)
+	outcome := publishFlights.Do(key, func() publishOutcome {
+		reply, err := e.postPublish(ctx, target, contentType, postBody)
+		return publishOutcome{
+			reply: reply,
+			err:   err,
+		}
+	})
+	return outcome.reply, outcome.err
+}
+
+func (e GogolemTestImpl) postPublish(ctx context.Context, target string, contentType string, postBody []byte) (publishReply, error) {
+	client := e.httpClient()
+	if e.config.Debug {
+		client = &http.Client{
+			Timeout: client.Timeout,
+			Transport: roundtrip.LoggingTransport{
+				Base: client.Transport,
+				Tap: func(reqDump, respDump []byte) {
+					fmt.Printf("%s\n\n%s\n", reqDump, respDump)
+				},
+			},
+		}
+	}
+	var response ResponseBody
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewBuffer(postBody))
+	if err != nil {
+		return publishReply{}, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if e.config.PublishGzip {
+		roundtrip.GzipRequest(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return publishReply{}, &PublishError{Kind: PublishErrorNetwork, Err: err}
+	}
+	defer drainAndClose(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return publishReply{}, &PublishError{Kind: PublishErrorStatus, Code: resp.StatusCode}
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		result.SetErr(fmt.Sprintln(err))
-		return result
+		return publishReply{}, &PublishError{Kind: PublishErrorNetwork, Err: err}
+	}
+	// A total accepted for later processing may be answered without a body
+	if resp.StatusCode == http.StatusAccepted && len(body) == 0 {
+		return publishReply{
+			status: resp.StatusCode,
+			header: resp.Header,
+		}, nil
 	}
 
-	var response ResponseBody
-	err = json.Unmarshal(body, &response)
+	if err := checkJSONContentType(resp.Header.Get("Content-Type"), body); err != nil {
+		return publishReply{}, &PublishError{Kind: PublishErrorDecode, Err: err}
+	}
+	if err := decodeJSON(bytes.NewReader(body), &response, e.config.StrictDecoding); err != nil {
+		return publishReply{}, &PublishError{Kind: PublishErrorDecode, Err: err}
+	}
+	return publishReply{
+		body:   response,
+		status: resp.StatusCode,
+		header: resp.Header,
+	}, nil
+}
+
+// maxDrainBytes bounds how much of an unread body drainAndClose discards
+const maxDrainBytes = 64 << 10
+
+// drainAndClose reads what is left of a response body, up to maxDrainBytes,
+// and closes it. A body that is read to its end lets the host finish the
+// incoming response and release its handles, and lets the underlying
+// connection be reused for the next request instead of being torn down.
+func drainAndClose(resp *http.Response) {
+	io.CopyN(ioutil.Discard, resp.Body, maxDrainBytes)
+	resp.Body.Close()
+}
+
+// streamPublish adds the values one by one and pushes the total after each
+// of them as a server-sent event, all over a single streaming POST. Each
+// event is flushed to the host as soon as it is written.
+//
+// The additions are all made before the request is sent, so they do not
+// depend on how far the stream gets: if it fails, every value has still
+// been added, which the error says.
+func (e GogolemTestImpl) streamPublish(values []uint64) error {
+	if e.configErr != nil {
+		return e.configErr
+	}
+
+	totals := make([]uint64, 0, len(values)+1)
+	totals = append(totals, total)
+	for _, value := range values {
+		e.Add(value)
+		totals = append(totals, total)
+	}
+
+	err := e.streamTotals(totals)
+	if err != nil {
+		return fmt.Errorf("added %d values, total is now %d, but streaming the totals failed: %w", len(values), total, err)
+	}
+	return nil
+}
+
+// streamTotals sends each of totals as a server-sent event
+func (e GogolemTestImpl) streamTotals(totals []uint64) error {
+	body, events := io.Pipe()
+	defer body.Close()
+	go func() {
+		var err error
+		for _, value := range totals {
+			if err = writeTotalEvent(events, value); err != nil {
+				break
+			}
+		}
+		events.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, e.config.PublishUrl, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "text/event-stream")
+
+	resp, err := e.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("stream publish failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+func writeTotalEvent(w io.Writer, total uint64) error {
+	data, err := json.Marshal(RequestBody{
+		CurrentTotal: total,
+	})
 	if err != nil {
-		result.SetErr(fmt.Sprintln(err))
-		return result
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: total\ndata: %s\n\n", data)
+	return err
+}
+
+// flush sends the accumulated deltas in a single POST. The delta is only
+// cleared when the server confirms with a 2xx status, so a failed flush is
+// retried as part of the next one. With nothing pending it returns without
+// sending anything, so hosts can call Flush before suspending a worker, as
+// Shutdown does.
+func (e GogolemTestImpl) flush() error {
+	if delta == 0 {
+		return nil
+	}
+	if e.configErr != nil {
+		return e.configErr
+	}
+
+	postBody, contentType, err := e.config.Encoder.Marshal(FlushRequestBody{
+		Deltas: delta,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.config.PublishUrl, bytes.NewBuffer(postBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.config.PublishGzip {
+		roundtrip.GzipRequest(req)
+	}
+	resp, err := e.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("flush failed with status %s", resp.Status)
 	}
 
-	fmt.Println(response.Message)
+	delta = 0
+	return nil
+}
 
-	result.Set(struct{}{})
-	return result
+// shutdown is meant to be called by the host before the worker is
+// suspended or updated. It flushes the pending deltas and is a cheap no-op
+// when nothing is pending.
+//
+// Shutdown runs as a regular invocation, so its outgoing request and the
+// cleared delta are recorded in the oplog before the worker is suspended. A
+// worker that is restored afterwards replays them and does not flush twice.
+//
+// Snapshots hold the pending deltas, so Shutdown has to come before
+// SaveSnapshot: a snapshot saved first still has the deltas, and a worker
+// loaded from it would send them again with its next Flush. If the flush
+// fails, the deltas stay pending and are in the snapshot, so none are lost.
+//
+// Idle connections of the client are closed too. WasiHttpTransport has no
+// connections of its own to close, the host manages them, so this only
+// matters for a Client with a pooling transport.
+func (e GogolemTestImpl) shutdown() error {
+	err := e.flush()
+	e.httpClient().CloseIdleConnections()
+	return err
 }
 
-func (e GogolemTestImpl) Pause() {
-	promise := gogolem_test.GolemApiHostGolemCreatePromise()
-	gogolem_test.GolemApiHostGolemAwaitPromise(promise)
+// healthCheck pings the /health path of the publish endpoint without
+// touching the counter state
+func (e GogolemTestImpl) healthCheck() error {
+	if e.configErr != nil {
+		return e.configErr
+	}
+
+	healthUrl, err := url.Parse(e.config.PublishUrl)
+	if err != nil {
+		return err
+	}
+	healthUrl.Path = "/health"
+	healthUrl.RawQuery = ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health check failed with status %s", resp.Status)
+	}
+	return nil
+}
+
+// health checks that the publish endpoint answers a HEAD request. Unlike
+// publishing it sends no data and changes no state, so it is safe to call
+// frequently.
+func (e GogolemTestImpl) health() error {
+	if e.configErr != nil {
+		return e.configErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, e.config.PublishUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("publish endpoint %s is unreachable: %v", e.config.PublishUrl, err)
+	}
+	defer drainAndClose(resp)
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("publish endpoint %s is unhealthy: %s", e.config.PublishUrl, resp.Status)
+	}
+	return nil
 }
 
 func main() {
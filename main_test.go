@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golem/template/promise"
+	"golem/template/roundtrip"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixedClock makes now return at for the duration of the test
+func fixedClock(t *testing.T, at time.Time) {
+	previous := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = previous })
+}
+
+// mockImpl returns an implementation with a fresh state whose requests are
+// answered by handler
+func mockImpl(t *testing.T, handler func(*http.Request) (*http.Response, error)) (GogolemTestImpl, *roundtrip.MockTransport) {
+	resetState(t)
+	fixedClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	transport := &roundtrip.MockTransport{Handler: handler}
+	return GogolemTestImpl{
+		publishBreaker: newCircuitBreaker(publishFailureThreshold, publishCooldown),
+		Client:         &http.Client{Transport: transport},
+		config: Config{
+			PublishUrl:  defaultPublishUrl,
+			Encoder:     JSONEncoder{},
+			HistorySize: defaultHistorySize,
+		},
+	}, transport
+}
+
+// respond answers every request with status and body
+func respond(status int, body string) func(*http.Request) (*http.Response, error) {
+	return func(request *http.Request) (*http.Response, error) {
+		response := roundtrip.MockResponse(request, status, body)
+		response.Header.Set("Content-Type", "application/json")
+		return response, nil
+	}
+}
+
+func TestGetChecked(t *testing.T) {
+	fixedClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	var e GogolemTestImpl
+
+	t.Run("never added", func(t *testing.T) {
+		resetState(t)
+		if got, ok := e.getChecked(); ok {
+			t.Fatalf("getChecked = %d, want none", got)
+		}
+	})
+	t.Run("added", func(t *testing.T) {
+		resetState(t)
+		e.Add(3)
+		if got, ok := e.getChecked(); !ok || got != 3 {
+			t.Fatalf("getChecked = %d, %v, want 3", got, ok)
+		}
+	})
+	t.Run("added then reset", func(t *testing.T) {
+		resetState(t)
+		e.Add(3)
+		e.GetAndReset()
+		if got, ok := e.getChecked(); !ok || got != 0 {
+			t.Fatalf("getChecked = %d, %v, want 0", got, ok)
+		}
+	})
+}
+
+func TestStreamPublish(t *testing.T) {
+	e, transport := mockImpl(t, nil)
+	e.Add(1)
+
+	if err := e.streamPublish([]uint64{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	requests := transport.Requests()
+	if len(requests) != 1 || requests[0].Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("requests = %+v", requests)
+	}
+	want := "event: total\ndata: {\"CurrentTotal\":1}\n\n" +
+		"event: total\ndata: {\"CurrentTotal\":3}\n\n" +
+		"event: total\ndata: {\"CurrentTotal\":6}\n\n"
+	if body := string(requests[0].Body); body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestStreamPublishFailureKeepsAdditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(*http.Request) (*http.Response, error)
+	}{
+		{"network", func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset")
+		}},
+		{"status", respond(http.StatusServiceUnavailable, "")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := mockImpl(t, test.handler)
+
+			err := e.streamPublish([]uint64{1, 2, 3})
+			if err == nil {
+				t.Fatal("streamPublish succeeded")
+			}
+			if total != 6 || delta != 6 {
+				t.Errorf("total, delta = %d, %d, want every value added", total, delta)
+			}
+			if !strings.Contains(err.Error(), "added 3 values, total is now 6") {
+				t.Errorf("error %q does not say the values were added", err)
+			}
+		})
+	}
+}
+
+func TestGetAndResetLosesNoAdd(t *testing.T) {
+	e, _ := mockImpl(t, nil)
+	const adders, adds = 4, 500
+
+	var wg sync.WaitGroup
+	for i := 0; i < adders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				e.Add(1)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	drained := make(chan uint64)
+	go func() {
+		var sum uint64
+		for {
+			select {
+			case <-done:
+				drained <- sum
+				return
+			default:
+				sum += e.GetAndReset()
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+
+	if got := <-drained + e.GetAndReset(); got != adders*adds {
+		t.Errorf("drained %d in total, want %d", got, adders*adds)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	e, transport := mockImpl(t, respond(http.StatusOK, ""))
+	e.Add(2)
+	e.Add(3)
+
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if delta != 0 {
+		t.Errorf("delta = %d after a flush, want 0", delta)
+	}
+	requests := transport.Requests()
+	if len(requests) != 1 || requests[0].Method != http.MethodPost || string(requests[0].Body) != `{"Deltas":5}` {
+		t.Fatalf("requests = %+v, want one POST of the deltas", requests)
+	}
+
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if requests := transport.Requests(); len(requests) != 1 {
+		t.Errorf("flush with nothing pending sent %d requests in total, want none more", len(requests))
+	}
+}
+
+func TestFlushFailureKeepsDelta(t *testing.T) {
+	e, transport := mockImpl(t, respond(http.StatusBadGateway, ""))
+	e.Add(4)
+
+	if err := e.flush(); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("flush = %v, want a 502 error", err)
+	}
+	if delta != 4 {
+		t.Errorf("delta = %d after a failed flush, want 4", delta)
+	}
+	if requests := transport.Requests(); len(requests) != 1 {
+		t.Errorf("sent %d requests, want 1", len(requests))
+	}
+}
+
+func TestPublishContentType(t *testing.T) {
+	const vendorType = "application/vnd.myorg.counter+json"
+	e, transport := mockImpl(t, respond(http.StatusOK, `{"Message":"ok"}`))
+	e.config.Encoder = JSONEncoder{ContentType: vendorType}
+	e.Add(5)
+
+	if _, err := e.publish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	requests := transport.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("sent %d requests, want a publish and a flush", len(requests))
+	}
+	for _, request := range requests {
+		if got := request.Header.Get("Content-Type"); got != vendorType {
+			t.Errorf("%s Content-Type = %q, want %q", request.Body, got, vendorType)
+		}
+	}
+}
+
+func TestFlushProto(t *testing.T) {
+	e, transport := mockImpl(t, respond(http.StatusOK, ""))
+	e.config.Encoder = ProtoEncoder{}
+	e.Add(5)
+
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	requests := transport.Requests()
+	if len(requests) != 1 || requests[0].Header.Get("Content-Type") != "application/x-protobuf" || string(requests[0].Body) != "\x08\x05" {
+		t.Fatalf("requests = %+v, want one protobuf FlushRequestBody", requests)
+	}
+}
+
+func TestAddAndPublish(t *testing.T) {
+	e, transport := mockImpl(t, respond(http.StatusOK, `{"Message":"stored"}`))
+	e.Add(2)
+
+	body, err := e.addAndPublish(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Message != "stored" {
+		t.Errorf("Message = %q, want stored", body.Message)
+	}
+	if got := e.Get(); got != 5 {
+		t.Errorf("Get = %d, want 5", got)
+	}
+	requests := transport.Requests()
+	if len(requests) != 1 || string(requests[0].Body) != `{"CurrentTotal":5}` {
+		t.Fatalf("requests = %+v, want one publish of 5", requests)
+	}
+}
+
+func TestAddAndPublishFailureKeepsAddition(t *testing.T) {
+	e, _ := mockImpl(t, respond(http.StatusServiceUnavailable, ""))
+	e.Add(2)
+
+	_, err := e.addAndPublish(3)
+	var publishErr *PublishError
+	if !errors.As(err, &publishErr) || publishErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("addAndPublish = %v, want a 503 PublishError", err)
+	}
+	if !strings.Contains(err.Error(), "added 3, total is now 5") {
+		t.Errorf("error %q does not report the addition", err)
+	}
+	if got := e.Get(); got != 5 {
+		t.Errorf("Get = %d after a failed publish, want 5", got)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	e, transport := mockImpl(t, respond(http.StatusNoContent, ""))
+
+	if err := e.health(); err != nil {
+		t.Fatal(err)
+	}
+	requests := transport.Requests()
+	if len(requests) != 1 || requests[0].Method != http.MethodHead || requests[0].URL != defaultPublishUrl {
+		t.Fatalf("requests = %+v, want one HEAD of the publish url", requests)
+	}
+}
+
+func TestHealthUnreachable(t *testing.T) {
+	tests := map[string]func(*http.Request) (*http.Response, error){
+		"network": func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+		"server error": respond(http.StatusInternalServerError, ""),
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, _ := mockImpl(t, handler)
+			err := e.health()
+			if err == nil || !strings.Contains(err.Error(), defaultPublishUrl) {
+				t.Fatalf("health = %v, want an error naming the publish url", err)
+			}
+		})
+	}
+}
+
+func TestEnsureAtLeast(t *testing.T) {
+	e, _ := mockImpl(t, nil)
+	e.Add(2)
+
+	if got := e.EnsureAtLeast(5); got != 5 {
+		t.Fatalf("EnsureAtLeast(5) = %d, want 5", got)
+	}
+	if delta != 5 || len(history) != 2 || history[1].value != 3 {
+		t.Fatalf("delta = %d, history = %+v, want the raise of 3 recorded", delta, history)
+	}
+
+	for _, value := range []uint64{5, 4, 0} {
+		if got := e.EnsureAtLeast(value); got != 5 {
+			t.Errorf("EnsureAtLeast(%d) = %d, want 5", value, got)
+		}
+	}
+	if delta != 5 || len(history) != 2 {
+		t.Errorf("delta = %d, history = %+v, want both unchanged by a no-op", delta, history)
+	}
+}
+
+// trackedBody records whether a response body was read to its end and closed
+type trackedBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestResponseBodiesAreDrainedAndClosed(t *testing.T) {
+	calls := map[string]func(GogolemTestImpl) error{
+		"publish": func(e GogolemTestImpl) error { _, err := e.publish(); return err },
+		"publishToTarget": func(e GogolemTestImpl) error {
+			_, err := e.publishToTarget(defaultPublishUrl)
+			return err
+		},
+		"streamPublish": func(e GogolemTestImpl) error { return e.streamPublish([]uint64{1, 2}) },
+		"flush":         func(e GogolemTestImpl) error { e.Add(1); return e.flush() },
+		"healthCheck":   GogolemTestImpl.healthCheck,
+		"health":        GogolemTestImpl.health,
+	}
+	for name, call := range calls {
+		for _, status := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+			t.Run(fmt.Sprintf("%s/%d", name, status), func(t *testing.T) {
+				var bodies []*trackedBody
+				e, _ := mockImpl(t, func(request *http.Request) (*http.Response, error) {
+					body := &trackedBody{Reader: strings.NewReader(`{"Message":"ok"}`)}
+					bodies = append(bodies, body)
+					response := roundtrip.MockResponse(request, status, "")
+					response.Header.Set("Content-Type", "application/json")
+					response.Body = body
+					return response, nil
+				})
+
+				err := call(e)
+				if (err == nil) != (status == http.StatusOK) {
+					t.Fatalf("err = %v with status %d", err, status)
+				}
+				if len(bodies) == 0 {
+					t.Fatal("no request was sent")
+				}
+				for i, body := range bodies {
+					if !body.closed || body.Len() != 0 {
+						t.Errorf("body %d: closed = %v with %d bytes unread, want drained and closed", i, body.closed, body.Len())
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGetAsync(t *testing.T) {
+	e, _ := mockImpl(t, nil)
+	host := &promise.MemoryHost{}
+	e.Promises = host
+	e.Add(5)
+
+	id := e.getAsync()
+	e.Add(1)
+
+	if data, ok := host.Completed(id); !ok || string(data) != `{"ok":5}` {
+		t.Errorf("promise completed with %s, %v, want the total of 5 at the call", data, ok)
+	}
+	if host.Len() != 1 {
+		t.Errorf("%d promises on the host, want the one left to the caller", host.Len())
+	}
+}
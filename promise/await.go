@@ -0,0 +1,28 @@
+//go:build tinygo.wasm
+
+package promise
+
+import (
+	"errors"
+	"fmt"
+
+	golem "golem/template/gogolem_test"
+)
+
+// Await blocks until the promise is completed and returns the value or the
+// error it was completed with
+func (p Promise[T]) Await() golem.Result[T, string] {
+	var result golem.Result[T, string]
+
+	value, err := decodePayload[T](p.host().AwaitPromise(p.Id))
+	var completed *completedError
+	switch {
+	case errors.As(err, &completed):
+		result.SetErr(completed.msg)
+	case err != nil:
+		result.SetErr(fmt.Sprintf("invalid payload for promise %s: %v", p.Id, err))
+	default:
+		result.Set(value)
+	}
+	return result
+}
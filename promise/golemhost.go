@@ -0,0 +1,23 @@
+//go:build tinygo.wasm
+
+package promise
+
+import (
+	golem "golem/template/gogolem_test"
+)
+
+func (GolemHost) CreatePromise() Id {
+	return FromHostId(golem.GolemApiHostGolemCreatePromise())
+}
+
+func (GolemHost) CompletePromise(id Id, data []byte) bool {
+	return golem.GolemApiHostGolemCompletePromise(id.HostId(), data)
+}
+
+func (GolemHost) AwaitPromise(id Id) []byte {
+	return golem.GolemApiHostGolemAwaitPromise(id.HostId())
+}
+
+func (GolemHost) DeletePromise(id Id) {
+	golem.GolemApiHostGolemDeletePromise(id.HostId())
+}
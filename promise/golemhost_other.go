@@ -0,0 +1,23 @@
+//go:build !tinygo.wasm
+
+package promise
+
+// errNoGolemHost is what GolemHost panics with outside a tinygo.wasm build,
+// where there is no host to hold the promises
+const errNoGolemHost = "promise: GolemHost needs the Golem host of a tinygo.wasm build, use a MemoryHost instead"
+
+func (GolemHost) CreatePromise() Id {
+	panic(errNoGolemHost)
+}
+
+func (GolemHost) CompletePromise(id Id, data []byte) bool {
+	panic(errNoGolemHost)
+}
+
+func (GolemHost) AwaitPromise(id Id) []byte {
+	panic(errNoGolemHost)
+}
+
+func (GolemHost) DeletePromise(id Id) {
+	panic(errNoGolemHost)
+}
@@ -0,0 +1,16 @@
+package promise
+
+// Host creates, completes and awaits promises. GolemHost goes through the
+// golem:api/host functions, MemoryHost keeps the promises in memory for
+// tests.
+type Host interface {
+	CreatePromise() Id
+	// CompletePromise returns false if the promise was already completed
+	CompletePromise(id Id, data []byte) bool
+	// AwaitPromise blocks until the promise is completed
+	AwaitPromise(id Id) []byte
+	DeletePromise(id Id)
+}
+
+// GolemHost is the Host of the worker, the Golem host it runs on
+type GolemHost struct{}
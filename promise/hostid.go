@@ -0,0 +1,31 @@
+//go:build tinygo.wasm
+
+package promise
+
+import (
+	golem "golem/template/gogolem_test"
+)
+
+// HostId returns the id in the form the golem:api/host functions take
+func (id Id) HostId() golem.GolemApiHostPromiseId {
+	var hostId golem.GolemApiHostPromiseId
+	hostId.WorkerId.TemplateId.Uuid = golem.GolemApiHostUuid{
+		HighBits: id.TemplateId.HighBits,
+		LowBits:  id.TemplateId.LowBits,
+	}
+	hostId.WorkerId.WorkerName = id.WorkerName
+	hostId.OplogIdx = id.OplogIdx
+	return hostId
+}
+
+// FromHostId converts an id returned by the golem:api/host functions
+func FromHostId(hostId golem.GolemApiHostPromiseId) Id {
+	return Id{
+		TemplateId: Uuid{
+			HighBits: hostId.WorkerId.TemplateId.Uuid.HighBits,
+			LowBits:  hostId.WorkerId.TemplateId.Uuid.LowBits,
+		},
+		WorkerName: hostId.WorkerId.WorkerName,
+		OplogIdx:   hostId.OplogIdx,
+	}
+}
@@ -0,0 +1,102 @@
+package promise
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Id identifies a Golem promise by the worker that created it and the oplog
+// index of its creation. Its string form, also used for JSON, is
+//
+//	<template-uuid>/<worker-name>/<oplog-idx>
+//
+// so it can be handed to an external system and parsed back with ParseId.
+type Id struct {
+	TemplateId Uuid
+	WorkerName string
+	OplogIdx   int32
+}
+
+func (id Id) String() string {
+	return fmt.Sprintf("%s/%s/%d", id.TemplateId, id.WorkerName, id.OplogIdx)
+}
+
+// ParseId parses the string form of an Id
+func ParseId(s string) (Id, error) {
+	first := strings.Index(s, "/")
+	last := strings.LastIndex(s, "/")
+	if first < 0 || first == last {
+		return Id{}, fmt.Errorf("invalid promise id %q", s)
+	}
+
+	templateId, err := ParseUuid(s[:first])
+	if err != nil {
+		return Id{}, fmt.Errorf("invalid promise id %q: %v", s, err)
+	}
+	oplogIdx, err := strconv.ParseInt(s[last+1:], 10, 32)
+	if err != nil {
+		return Id{}, fmt.Errorf("invalid promise id %q: %v", s, err)
+	}
+
+	return Id{
+		TemplateId: templateId,
+		WorkerName: s[first+1 : last],
+		OplogIdx:   int32(oplogIdx),
+	}, nil
+}
+
+func (id Id) MarshalJSON() ([]byte, error) {
+	return json.Marshal(id.String())
+}
+
+func (id *Id) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseId(s)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// Uuid is a uuid split in two halves, as the Golem host passes it
+type Uuid struct {
+	HighBits uint64
+	LowBits  uint64
+}
+
+// String returns the canonical 8-4-4-4-12 form of the uuid
+func (u Uuid) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		u.HighBits>>32,
+		(u.HighBits>>16)&0xffff,
+		u.HighBits&0xffff,
+		u.LowBits>>48,
+		u.LowBits&0xffffffffffff,
+	)
+}
+
+// ParseUuid parses the canonical form of a uuid
+func ParseUuid(s string) (Uuid, error) {
+	hex := strings.ReplaceAll(s, "-", "")
+	if len(s) != 36 || len(hex) != 32 {
+		return Uuid{}, fmt.Errorf("invalid uuid %q", s)
+	}
+	high, err := strconv.ParseUint(hex[:16], 16, 64)
+	if err != nil {
+		return Uuid{}, fmt.Errorf("invalid uuid %q", s)
+	}
+	low, err := strconv.ParseUint(hex[16:], 16, 64)
+	if err != nil {
+		return Uuid{}, fmt.Errorf("invalid uuid %q", s)
+	}
+	return Uuid{
+		HighBits: high,
+		LowBits:  low,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package promise
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIdString(t *testing.T) {
+	id := Id{
+		TemplateId: Uuid{HighBits: 0x0123456789abcdef, LowBits: 0xfedcba9876543210},
+		WorkerName: "counter/1",
+		OplogIdx:   42,
+	}
+	const want = "01234567-89ab-cdef-fedc-ba9876543210/counter/1/42"
+	if got := id.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+
+	parsed, err := ParseId(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != id {
+		t.Errorf("ParseId(%q) = %+v, want %+v", want, parsed, id)
+	}
+}
+
+func TestIdJSON(t *testing.T) {
+	id := Id{TemplateId: Uuid{HighBits: 1, LowBits: 2}, WorkerName: "w", OplogIdx: 7}
+	data, err := json.Marshal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"00000000-0000-0001-0000-000000000002/w/7"` {
+		t.Errorf("json.Marshal = %s", data)
+	}
+	var decoded Id
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != id {
+		t.Errorf("json.Unmarshal(%s) = %+v, %v, want %+v", data, decoded, err, id)
+	}
+}
+
+func TestParseIdInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"01234567-89ab-cdef-fedc-ba9876543210",
+		"01234567-89ab-cdef-fedc-ba9876543210/42",
+		"0123456789abcdeffedcba9876543210/w/1",
+		"01234567-89ab-cdef-fedc-ba987654321g/w/1",
+		"01234567-89ab-cdef-fedc-ba9876543210/w/idx",
+		"01234567-89ab-cdef-fedc-ba9876543210/w/2147483648",
+	} {
+		if id, err := ParseId(s); err == nil {
+			t.Errorf("ParseId(%q) = %+v, want an error", s, id)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package promise
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryHost is a Host for tests that keeps the promises in memory, so
+// they can be used without a Golem host. Its zero value is ready to use.
+type MemoryHost struct {
+	mu       sync.Mutex
+	created  int32
+	promises map[Id]*memoryPromise
+}
+
+type memoryPromise struct {
+	done chan struct{}
+	data []byte
+}
+
+func (h *MemoryHost) CreatePromise() Id {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.promises == nil {
+		h.promises = map[Id]*memoryPromise{}
+	}
+	h.created++
+	id := Id{
+		WorkerName: "memory",
+		OplogIdx:   h.created,
+	}
+	h.promises[id] = &memoryPromise{
+		done: make(chan struct{}),
+	}
+	return id
+}
+
+func (h *MemoryHost) CompletePromise(id Id, data []byte) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.promise(id)
+	select {
+	case <-p.done:
+		return false
+	default:
+		p.data = data
+		close(p.done)
+		return true
+	}
+}
+
+func (h *MemoryHost) AwaitPromise(id Id) []byte {
+	h.mu.Lock()
+	p := h.promise(id)
+	h.mu.Unlock()
+
+	<-p.done
+	return p.data
+}
+
+func (h *MemoryHost) DeletePromise(id Id) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.promises, id)
+}
+
+// Completed returns the payload the promise was completed with, and false
+// if it is not completed yet
+func (h *MemoryHost) Completed(id Id) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.promise(id)
+	select {
+	case <-p.done:
+		return p.data, true
+	default:
+		return nil, false
+	}
+}
+
+// Len returns the number of promises created and not deleted
+func (h *MemoryHost) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.promises)
+}
+
+// promise panics on an unknown id, like the Golem host traps on one
+func (h *MemoryHost) promise(id Id) *memoryPromise {
+	p, ok := h.promises[id]
+	if !ok {
+		panic(fmt.Sprintf("promise: unknown promise %s", id))
+	}
+	return p
+}
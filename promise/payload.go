@@ -0,0 +1,56 @@
+package promise
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// payload is the JSON form a promise is completed with, {"ok": value} or
+// {"err": message}
+type payload[T any] struct {
+	Ok  *T      `json:"ok,omitempty"`
+	Err *string `json:"err,omitempty"`
+}
+
+func encodeOk[T any](value T) ([]byte, error) {
+	return json.Marshal(payload[T]{Ok: &value})
+}
+
+func encodeErr(msg string) ([]byte, error) {
+	return json.Marshal(payload[struct{}]{Err: &msg})
+}
+
+// completedError is the message of a promise completed with CompleteErr
+type completedError struct {
+	msg string
+}
+
+func (e *completedError) Error() string {
+	return e.msg
+}
+
+// decodePayload decodes the value of a completed promise. It returns a
+// *completedError if the promise was completed with an error, and any
+// other error if data is not a valid payload.
+func decodePayload[T any](data []byte) (T, error) {
+	var value T
+	// The value is kept raw first so an ok value encoded as null is still
+	// told apart from a missing one
+	var completed struct {
+		Ok  json.RawMessage `json:"ok"`
+		Err *string         `json:"err"`
+	}
+	if err := json.Unmarshal(data, &completed); err != nil {
+		return value, err
+	}
+
+	switch {
+	case completed.Err != nil:
+		return value, &completedError{msg: *completed.Err}
+	case completed.Ok != nil:
+		err := json.Unmarshal(completed.Ok, &value)
+		return value, err
+	default:
+		return value, errors.New("neither ok nor err")
+	}
+}
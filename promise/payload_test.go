@@ -0,0 +1,59 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPayloadOk(t *testing.T) {
+	data, err := encodeOk(uint64(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"ok":42}` {
+		t.Errorf("encodeOk(42) = %s", data)
+	}
+	value, err := decodePayload[uint64](data)
+	if err != nil || value != 42 {
+		t.Errorf("decodePayload(%s) = %d, %v, want 42", data, value, err)
+	}
+}
+
+func TestPayloadErr(t *testing.T) {
+	data, err := encodeErr("cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"err":"cancelled"}` {
+		t.Errorf(`encodeErr("cancelled") = %s`, data)
+	}
+	_, err = decodePayload[uint64](data)
+	var completed *completedError
+	if !errors.As(err, &completed) || completed.msg != "cancelled" {
+		t.Errorf("decodePayload(%s) = %v, want the completion error", data, err)
+	}
+}
+
+func TestPayloadNullOk(t *testing.T) {
+	data, err := encodeOk[*uint64](nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"ok":null}` {
+		t.Errorf("encodeOk(nil) = %s", data)
+	}
+	value, err := decodePayload[*uint64](data)
+	if err != nil || value != nil {
+		t.Errorf("decodePayload(%s) = %v, %v, want a nil value", data, value, err)
+	}
+}
+
+func TestPayloadInvalid(t *testing.T) {
+	for _, data := range []string{`{}`, `{"other":1}`, `[]`, `not json`, `{"ok":"42"}`} {
+		_, err := decodePayload[uint64]([]byte(data))
+		var completed *completedError
+		if err == nil || errors.As(err, &completed) {
+			t.Errorf("decodePayload(%s) = %v, want an invalid payload error", data, err)
+		}
+	}
+}
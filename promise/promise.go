@@ -0,0 +1,58 @@
+package promise
+
+// Promise is a Golem promise whose payload is a JSON encoded T
+type Promise[T any] struct {
+	Id Id
+	// Host holds the promise, GolemHost if nil
+	Host Host
+}
+
+// New creates a new promise on host, or on the Golem host if host is nil
+func New[T any](host Host) Promise[T] {
+	p := Promise[T]{
+		Host: host,
+	}
+	p.Id = p.host().CreatePromise()
+	return p
+}
+
+// FromId wraps an existing promise of host, for example one created by
+// another invocation
+func FromId[T any](host Host, id Id) Promise[T] {
+	return Promise[T]{
+		Id:   id,
+		Host: host,
+	}
+}
+
+// Complete completes the promise with value. It returns false if the
+// promise was already completed.
+func (p Promise[T]) Complete(value T) (bool, error) {
+	return p.complete(encodeOk(value))
+}
+
+// CompleteErr completes the promise with an error, which Await returns as
+// the error variant of its Result. It returns false if the promise was
+// already completed.
+func (p Promise[T]) CompleteErr(msg string) (bool, error) {
+	return p.complete(encodeErr(msg))
+}
+
+func (p Promise[T]) complete(data []byte, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return p.host().CompletePromise(p.Id, data), nil
+}
+
+// Delete removes the promise from its host
+func (p Promise[T]) Delete() {
+	p.host().DeletePromise(p.Id)
+}
+
+func (p Promise[T]) host() Host {
+	if p.Host != nil {
+		return p.Host
+	}
+	return GolemHost{}
+}
@@ -0,0 +1,56 @@
+package promise
+
+import (
+	"testing"
+)
+
+func TestPromiseComplete(t *testing.T) {
+	host := &MemoryHost{}
+	p := New[uint64](host)
+
+	if done, err := p.Complete(5); err != nil || !done {
+		t.Fatalf("Complete = %v, %v, want true", done, err)
+	}
+	if done, err := p.CompleteErr("too late"); err != nil || done {
+		t.Errorf("second completion = %v, %v, want false", done, err)
+	}
+	if data := host.AwaitPromise(p.Id); string(data) != `{"ok":5}` {
+		t.Errorf("payload = %s, want the first completion", data)
+	}
+}
+
+func TestPromiseFromId(t *testing.T) {
+	host := &MemoryHost{}
+	created := New[string](host)
+	p := FromId[string](host, created.Id)
+
+	if _, err := p.CompleteErr("cancelled"); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := host.Completed(created.Id); !ok || string(data) != `{"err":"cancelled"}` {
+		t.Errorf("Completed = %s, %v, want the error payload", data, ok)
+	}
+
+	p.Delete()
+	if host.Len() != 0 {
+		t.Errorf("%d promises left after Delete", host.Len())
+	}
+}
+
+func TestMemoryHostAwaitBlocks(t *testing.T) {
+	host := &MemoryHost{}
+	p := New[uint64](host)
+
+	awaited := make(chan []byte)
+	go func() { awaited <- host.AwaitPromise(p.Id) }()
+	select {
+	case data := <-awaited:
+		t.Fatalf("AwaitPromise returned %s before the completion", data)
+	default:
+	}
+
+	p.Complete(7)
+	if data := <-awaited; string(data) != `{"ok":7}` {
+		t.Errorf("AwaitPromise = %s, want the completion", data)
+	}
+}
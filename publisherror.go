@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// PublishErrorKind tells why publishing failed
+type PublishErrorKind int
+
+const (
+	// PublishErrorNetwork is a request that got no response, including
+	// one refused because the publish circuit is open
+	PublishErrorNetwork PublishErrorKind = iota
+	// PublishErrorStatus is a response with a non-2xx status
+	PublishErrorStatus
+	// PublishErrorDecode is a response whose body could not be decoded
+	PublishErrorDecode
+)
+
+// PublishError is the error returned when publishing fails
+type PublishError struct {
+	Kind PublishErrorKind
+	// Code is the response status, for PublishErrorStatus
+	Code int
+	Err  error
+}
+
+func (e *PublishError) String() string {
+	switch e.Kind {
+	case PublishErrorStatus:
+		return fmt.Sprintf("publish failed with status %d %s", e.Code, http.StatusText(e.Code))
+	case PublishErrorDecode:
+		return fmt.Sprintf("failed to decode publish response: %v", e.Err)
+	default:
+		return fmt.Sprintf("failed to send publish request: %v", e.Err)
+	}
+}
+
+func (e *PublishError) Error() string {
+	return e.String()
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// witCase returns the case of the api's publish-error variant e converts
+// to, with its payload: the status code of a status error, or the message
+// of the others. Unknown kinds are network errors.
+func (e *PublishError) witCase() (PublishErrorKind, uint16, string) {
+	switch e.Kind {
+	case PublishErrorStatus:
+		return PublishErrorStatus, uint16(e.Code), ""
+	case PublishErrorDecode:
+		return PublishErrorDecode, 0, e.String()
+	default:
+		return PublishErrorNetwork, 0, e.String()
+	}
+}
+
+// asPublishError returns err as a *PublishError, treating errors that are
+// not one as network errors
+func asPublishError(err error) *PublishError {
+	var publishErr *PublishError
+	if errors.As(err, &publishErr) {
+		return publishErr
+	}
+	return &PublishError{
+		Kind: PublishErrorNetwork,
+		Err:  err,
+	}
+}
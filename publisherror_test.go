@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPublishErrorString(t *testing.T) {
+	cause := errors.New("connection refused")
+	tests := []struct {
+		err  *PublishError
+		want string
+	}{
+		{&PublishError{Kind: PublishErrorNetwork, Err: cause}, "failed to send publish request: connection refused"},
+		{&PublishError{Kind: PublishErrorStatus, Code: 503}, "publish failed with status 503 Service Unavailable"},
+		{&PublishError{Kind: PublishErrorDecode, Err: cause}, "failed to decode publish response: connection refused"},
+	}
+	for _, test := range tests {
+		if got := test.err.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestAsPublishError(t *testing.T) {
+	statusErr := &PublishError{Kind: PublishErrorStatus, Code: 500}
+	if got := asPublishError(fmt.Errorf("publishing: %w", statusErr)); got != statusErr {
+		t.Errorf("asPublishError of a wrapped PublishError = %+v, want it unwrapped", got)
+	}
+
+	foreign := errors.New("circuit open")
+	got := asPublishError(foreign)
+	if got.Kind != PublishErrorNetwork || !errors.Is(got, foreign) {
+		t.Errorf("asPublishError(%v) = %+v, want a network error wrapping it", foreign, got)
+	}
+}
+
+func TestPublishErrorWitCase(t *testing.T) {
+	cause := errors.New("unexpected EOF")
+	tests := []struct {
+		err     *PublishError
+		kind    PublishErrorKind
+		code    uint16
+		message string
+	}{
+		{&PublishError{Kind: PublishErrorNetwork, Err: cause}, PublishErrorNetwork, 0, "failed to send publish request: unexpected EOF"},
+		{&PublishError{Kind: PublishErrorStatus, Code: 429}, PublishErrorStatus, 429, ""},
+		{&PublishError{Kind: PublishErrorDecode, Err: cause}, PublishErrorDecode, 0, "failed to decode publish response: unexpected EOF"},
+		{&PublishError{Kind: PublishErrorKind(42), Err: cause}, PublishErrorNetwork, 0, "failed to send publish request: unexpected EOF"},
+	}
+	for _, test := range tests {
+		kind, code, message := test.err.witCase()
+		if kind != test.kind || code != test.code || message != test.message {
+			t.Errorf("witCase of %+v = %v, %d, %q, want %v, %d, %q", test.err, kind, code, message, test.kind, test.code, test.message)
+		}
+	}
+}
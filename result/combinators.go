@@ -0,0 +1,47 @@
+package result
+
+// result is the method set the generated Result[T, E] has on its value
+type result[T any, E any] interface {
+	IsErr() bool
+	Unwrap() T
+	UnwrapErr() E
+}
+
+// resultPtr is the method set of a pointer to a Result R, through which a
+// zero R is made ok or an error
+type resultPtr[R any, T any, E any] interface {
+	*R
+	Set(T) T
+	SetErr(E) E
+}
+
+// The combinators below are written against these method sets rather than
+// the generated Result, so that they build and are tested without it. The
+// exported functions instantiate them with the generated type.
+
+func flatten[T any, E any, R result[T, E], P resultPtr[R, T, E], Outer result[R, E]](r Outer) R {
+	if r.IsErr() {
+		var flat R
+		P(&flat).SetErr(r.UnwrapErr())
+		return flat
+	}
+	return r.Unwrap()
+}
+
+func or[T any, E any, F any, R result[T, E], O result[T, F], P resultPtr[O, T, F]](r R, other O) O {
+	if r.IsErr() {
+		return other
+	}
+	var ok O
+	P(&ok).Set(r.Unwrap())
+	return ok
+}
+
+func and[T any, U any, E any, R result[T, E], O result[U, E], P resultPtr[O, U, E]](r R, other O) O {
+	if r.IsErr() {
+		var err O
+		P(&err).SetErr(r.UnwrapErr())
+		return err
+	}
+	return other
+}
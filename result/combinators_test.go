@@ -0,0 +1,105 @@
+package result
+
+import (
+	"errors"
+	"testing"
+)
+
+// testResult has the methods of the generated Result, which only exists in
+// a tinygo.wasm build
+type testResult[T any, E any] struct {
+	isErr bool
+	val   T
+	err   E
+}
+
+func (r testResult[T, E]) IsErr() bool  { return r.isErr }
+func (r testResult[T, E]) Unwrap() T    { return r.val }
+func (r testResult[T, E]) UnwrapErr() E { return r.err }
+
+func (r *testResult[T, E]) Set(val T) T {
+	*r = testResult[T, E]{val: val}
+	return val
+}
+
+func (r *testResult[T, E]) SetErr(err E) E {
+	*r = testResult[T, E]{isErr: true, err: err}
+	return err
+}
+
+func ok[T any, E any](val T) testResult[T, E] {
+	var r testResult[T, E]
+	r.Set(val)
+	return r
+}
+
+func fail[T any, E any](err E) testResult[T, E] {
+	var r testResult[T, E]
+	r.SetErr(err)
+	return r
+}
+
+var errFallback = errors.New("fallback failed")
+
+type nested = testResult[testResult[int, string], string]
+
+func testFlatten(r nested) testResult[int, string] {
+	return flatten[int, string, testResult[int, string], *testResult[int, string]](r)
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		name string
+		r    nested
+		want testResult[int, string]
+	}{
+		{"outer err", fail[testResult[int, string]]("outer"), fail[int]("outer")},
+		{"inner err", ok[testResult[int, string], string](fail[int]("inner")), fail[int]("inner")},
+		{"both ok", ok[testResult[int, string], string](ok[int, string](7)), ok[int, string](7)},
+	}
+	for _, test := range tests {
+		if got := testFlatten(test.r); got != test.want {
+			t.Errorf("%s: Flatten = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOr(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     testResult[int, string]
+		other testResult[int, error]
+		want  testResult[int, error]
+	}{
+		{"ok, ok", ok[int, string](1), ok[int, error](2), ok[int, error](1)},
+		{"ok, err", ok[int, string](1), fail[int, error](errFallback), ok[int, error](1)},
+		{"err, ok", fail[int]("primary"), ok[int, error](2), ok[int, error](2)},
+		{"err, err", fail[int]("primary"), fail[int, error](errFallback), fail[int, error](errFallback)},
+	}
+	for _, test := range tests {
+		got := or[int, string, error, testResult[int, string], testResult[int, error], *testResult[int, error]](test.r, test.other)
+		if got != test.want {
+			t.Errorf("%s: Or = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     testResult[int, string]
+		other testResult[bool, string]
+		want  testResult[bool, string]
+	}{
+		{"ok, ok", ok[int, string](1), ok[bool, string](true), ok[bool, string](true)},
+		{"ok, err", ok[int, string](1), fail[bool]("second"), fail[bool]("second")},
+		{"err, ok", fail[int]("first"), ok[bool, string](true), fail[bool]("first")},
+		{"err, err", fail[int]("first"), fail[bool]("second"), fail[bool]("first")},
+	}
+	for _, test := range tests {
+		got := and[int, bool, string, testResult[int, string], testResult[bool, string], *testResult[bool, string]](test.r, test.other)
+		if got != test.want {
+			t.Errorf("%s: And = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
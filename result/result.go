@@ -0,0 +1,23 @@
+//go:build tinygo.wasm
+
+package result
+
+import (
+	golem "golem/template/gogolem_test"
+)
+
+// Flatten collapses a nested Result: the outer error if r is an error,
+// otherwise the inner Result as is
+func Flatten[T any, E any](r golem.Result[golem.Result[T, E], E]) golem.Result[T, E] {
+	return flatten[T, E, golem.Result[T, E], *golem.Result[T, E]](r)
+}
+
+// Or returns r as is if it is ok, otherwise other
+func Or[T any, E any, F any](r golem.Result[T, E], other golem.Result[T, F]) golem.Result[T, F] {
+	return or[T, E, F, golem.Result[T, E], golem.Result[T, F], *golem.Result[T, F]](r, other)
+}
+
+// And returns other if r is ok, otherwise the error of r
+func And[T any, U any, E any](r golem.Result[T, E], other golem.Result[U, E]) golem.Result[U, E] {
+	return and[T, U, E, golem.Result[T, E], golem.Result[U, E], *golem.Result[U, E]](r, other)
+}
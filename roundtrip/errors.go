@@ -0,0 +1,84 @@
+package roundtrip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FailureKind classifies why a request failed before any response arrived
+type FailureKind int
+
+const (
+	// FailureUnknown is any error not reported by the wasi:http host
+	FailureUnknown FailureKind = iota
+	// FailureInvalidUrl means the host rejected the request target
+	FailureInvalidUrl
+	// FailureTimeout means a connect, first byte or between bytes timeout
+	// expired, or the request deadline passed
+	FailureTimeout
+	// FailureProtocol means the exchange with the server broke HTTP
+	FailureProtocol
+	// FailureUnexpected covers the other host failures, such as a failed
+	// DNS lookup, TLS handshake or refused connection; Error.Message tells
+	// them apart
+	FailureUnexpected
+)
+
+func (k FailureKind) String() string {
+	switch k {
+	case FailureInvalidUrl:
+		return "invalid url"
+	case FailureTimeout:
+		return "timeout"
+	case FailureProtocol:
+		return "protocol error"
+	case FailureUnexpected:
+		return "unexpected error"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a request failure reported by the wasi:http host, mirroring the
+// variants of its error type
+type Error struct {
+	Kind    FailureKind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Failed to send request: %s: %s", e.Kind, e.Message)
+}
+
+// newWasiError returns the Error for a case of the wasi:http error variant,
+// named as in the WIT, carrying message. Cases added to the variant later
+// are unexpected errors.
+func newWasiError(variant string, message string) *Error {
+	kind := FailureUnexpected
+	switch variant {
+	case "invalid-url":
+		kind = FailureInvalidUrl
+	case "timeout-error":
+		kind = FailureTimeout
+	case "protocol-error":
+		kind = FailureProtocol
+	}
+	return &Error{
+		Kind:    kind,
+		Message: message,
+	}
+}
+
+// ClassifyError returns the kind of failure behind err, which may be wrapped,
+// for example in the *url.Error returned by http.Client
+func ClassifyError(err error) FailureKind {
+	var wasiErr *Error
+	if errors.As(err, &wasiErr) {
+		return wasiErr.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return FailureTimeout
+	}
+	return FailureUnknown
+}
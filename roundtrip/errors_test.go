@@ -0,0 +1,52 @@
+package roundtrip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestNewWasiError(t *testing.T) {
+	tests := []struct {
+		variant string
+		kind    FailureKind
+	}{
+		{"invalid-url", FailureInvalidUrl},
+		{"timeout-error", FailureTimeout},
+		{"protocol-error", FailureProtocol},
+		{"unexpected-error", FailureUnexpected},
+		{"some-future-error", FailureUnexpected},
+	}
+	for _, test := range tests {
+		err := newWasiError(test.variant, "details")
+		if err.Kind != test.kind || err.Message != "details" {
+			t.Errorf("newWasiError(%q) = %+v, want kind %s", test.variant, err, test.kind)
+		}
+		want := fmt.Sprintf("Failed to send request: %s: details", test.kind)
+		if err.Error() != want {
+			t.Errorf("newWasiError(%q).Error() = %q, want %q", test.variant, err.Error(), want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want FailureKind
+	}{
+		{"wasi error", newWasiError("protocol-error", "bad chunk"), FailureProtocol},
+		{"wrapped in *url.Error", &url.Error{Op: "Get", URL: "http://example.com/", Err: newWasiError("invalid-url", "no host")}, FailureInvalidUrl},
+		{"deadline exceeded", context.DeadlineExceeded, FailureTimeout},
+		{"deadline exceeded in *url.Error", &url.Error{Op: "Post", URL: "http://example.com/", Err: context.DeadlineExceeded}, FailureTimeout},
+		{"other error", errors.New("connection reset"), FailureUnknown},
+		{"nil", nil, FailureUnknown},
+	}
+	for _, test := range tests {
+		if got := ClassifyError(test.err); got != test.want {
+			t.Errorf("%s: ClassifyError = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package roundtrip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ETagTransport wraps another RoundTripper with a cache of GET responses
+// keyed by URL. When a cached response carried an ETag, the next GET of the
+// same URL is sent with If-None-Match, and a 304 Not Modified answer is
+// turned into a 200 response replaying the cached body.
+//
+// The cache lives in memory and holds whole bodies, so it is meant for
+// small resources fetched repeatedly.
+type ETagTransport struct {
+	// Base is the transport doing the actual work, WasiHttpTransport if nil
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+func (t *ETagTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = WasiHttpTransport{}
+	}
+	if request.Method != "" && request.Method != http.MethodGet {
+		return base.RoundTrip(request)
+	}
+
+	key := request.URL.String()
+	entry, cached := t.lookup(key)
+	// A request carrying its own If-None-Match gets the server's 304 as is
+	conditional := cached && request.Header.Get("If-None-Match") == ""
+	if conditional {
+		request = request.Clone(request.Context())
+		request.Header.Set("If-None-Match", entry.etag)
+	}
+
+	response, err := base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && conditional:
+		response.Body.Close()
+		return cachedResponse(request, entry), nil
+	case response.StatusCode == http.StatusOK && response.Header.Get("ETag") != "":
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.store(key, etagEntry{
+			etag:   response.Header.Get("ETag"),
+			header: response.Header.Clone(),
+			body:   body,
+		})
+		response.Body = io.NopCloser(bytes.NewReader(body))
+		return response, nil
+	default:
+		return response, nil
+	}
+}
+
+func (t *ETagTransport) lookup(key string) (etagEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[key]
+	return entry, ok
+}
+
+func (t *ETagTransport) store(key string, entry etagEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = map[string]etagEntry{}
+	}
+	t.entries[key] = entry
+}
+
+func cachedResponse(request *http.Request, entry etagEntry) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.header.Clone(),
+		ContentLength: int64(len(entry.body)),
+		Body:          io.NopCloser(bytes.NewReader(entry.body)),
+		Request:       request,
+	}
+}
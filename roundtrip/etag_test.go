@@ -0,0 +1,67 @@
+package roundtrip
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// etagServer answers GETs with a body and an ETag, and with 304 Not
+// Modified when the request already has that ETag
+func etagServer() *MockTransport {
+	return &MockTransport{
+		Handler: func(request *http.Request) (*http.Response, error) {
+			if request.Header.Get("If-None-Match") == `"v1"` {
+				return MockResponse(request, http.StatusNotModified, ""), nil
+			}
+			response := MockResponse(request, http.StatusOK, "original body")
+			response.Header.Set("ETag", `"v1"`)
+			return response, nil
+		},
+	}
+}
+
+func get(t *testing.T, client *http.Client, header http.Header) (*http.Response, string) {
+	t.Helper()
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/resource", nil)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(body)
+}
+
+func TestETagTransportReusesCachedBodyOn304(t *testing.T) {
+	server := etagServer()
+	client := &http.Client{Transport: &ETagTransport{Base: server}}
+
+	get(t, client, nil)
+	response, body := get(t, client, nil)
+
+	if response.StatusCode != http.StatusOK || body != "original body" {
+		t.Fatalf("second GET = %d %q, want 200 %q", response.StatusCode, body, "original body")
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("second request was not conditional: %+v", requests)
+	}
+}
+
+func TestETagTransportKeepsCallers304(t *testing.T) {
+	client := &http.Client{Transport: &ETagTransport{Base: etagServer()}}
+
+	get(t, client, nil)
+	response, body := get(t, client, http.Header{"If-None-Match": {`"v1"`}})
+
+	if response.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("conditional GET = %d %q, want 304 with no body", response.StatusCode, body)
+	}
+}
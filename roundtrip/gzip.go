@@ -0,0 +1,55 @@
+package roundtrip
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// MinGzipSize is the body size below which GzipRequest does not compress
+const MinGzipSize = 1024
+
+// GzipRequest makes request send its body gzip-compressed, with a
+// Content-Encoding: gzip header. The body is compressed while the transport
+// writes it to the output stream, so the whole of it is never buffered.
+//
+// Bodies known to be smaller than MinGzipSize, for which compression costs
+// more than it saves, and requests that already have a Content-Encoding are
+// left as they are.
+func GzipRequest(request *http.Request) {
+	if request.Body == nil || request.Body == http.NoBody || request.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	if request.ContentLength > 0 && request.ContentLength < MinGzipSize {
+		return
+	}
+
+	request.Body = gzipBody(request.Body)
+	request.ContentLength = -1
+	if getBody := request.GetBody; getBody != nil {
+		request.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return gzipBody(body), nil
+		}
+	}
+	request.Header.Set("Content-Encoding", "gzip")
+}
+
+// gzipBody returns a reader of the compressed body, compressing in a
+// goroutine as the reader is read
+func gzipBody(body io.ReadCloser) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(w)
+		_, err := io.Copy(zw, body)
+		body.Close()
+		if err == nil {
+			err = zw.Close()
+		}
+		w.CloseWithError(err)
+	}()
+	return r
+}
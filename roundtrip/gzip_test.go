@@ -0,0 +1,85 @@
+package roundtrip
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// gunzipEcho answers with the request body, decompressed if it is gzipped
+func gunzipEcho(request *http.Request) (*http.Response, error) {
+	body := request.Body
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = zr
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return MockResponse(request, http.StatusOK, string(data)), nil
+}
+
+func echo(t *testing.T, transport http.RoundTripper, request *http.Request) string {
+	t.Helper()
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGzipRequestRoundTrip(t *testing.T) {
+	payload := strings.Repeat(`{"CurrentTotal":12345}`, 100)
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(payload))
+	GzipRequest(request)
+
+	if request.Header.Get("Content-Encoding") != "gzip" || request.ContentLength != -1 {
+		t.Fatalf("request not set up for gzip: %v, length %d", request.Header, request.ContentLength)
+	}
+	server := &MockTransport{Handler: gunzipEcho}
+	if got := echo(t, server, request); got != payload {
+		t.Fatalf("echoed %d bytes, want the %d bytes sent", len(got), len(payload))
+	}
+	if sent := len(server.Requests()[0].Body); sent >= len(payload) {
+		t.Fatalf("sent %d bytes for a %d byte payload", sent, len(payload))
+	}
+}
+
+func TestGzipRequestSkipsSmallBodies(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(`{"CurrentTotal":1}`))
+	GzipRequest(request)
+
+	if request.Header.Get("Content-Encoding") != "" {
+		t.Fatal("a body below MinGzipSize was compressed")
+	}
+	if got := echo(t, &MockTransport{Handler: gunzipEcho}, request); got != `{"CurrentTotal":1}` {
+		t.Fatalf("echoed %q", got)
+	}
+}
+
+func TestGzipRequestRewrapsGetBody(t *testing.T) {
+	payload := strings.Repeat("a", 2*MinGzipSize)
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(payload))
+	GzipRequest(request)
+
+	body, err := request.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry := request.Clone(request.Context())
+	retry.Body = body
+	if got := echo(t, &MockTransport{Handler: gunzipEcho}, retry); got != payload {
+		t.Fatalf("resent body decompressed to %d bytes, want %d", len(got), len(payload))
+	}
+}
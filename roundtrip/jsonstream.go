@@ -0,0 +1,54 @@
+package roundtrip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GetJSONStream sends a GET request for url with client, or through
+// WasiHttpTransport if client is nil, and decodes the JSON array it answers
+// with one element at a time, as the body arrives, calling onItem with each
+// element. It returns the number of elements passed to onItem. When onItem
+// returns an error, decoding stops and the error is returned as is; the
+// rest of the body is never read.
+func GetJSONStream[T any](client *http.Client, url string, onItem func(T) error) (int, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := orWasiClient(client).Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return 0, fmt.Errorf("roundtrip: GET %s failed with status %s", url, response.Status)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	if token, err := decoder.Token(); err != nil {
+		return 0, fmt.Errorf("roundtrip: failed to decode JSON array: %w", err)
+	} else if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("roundtrip: expected a JSON array but got %v", token)
+	}
+
+	count := 0
+	for decoder.More() {
+		var item T
+		if err := decoder.Decode(&item); err != nil {
+			return count, fmt.Errorf("roundtrip: failed to decode element %d of JSON array: %w", count, err)
+		}
+		count++
+		if err := onItem(item); err != nil {
+			return count, err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return count, fmt.Errorf("roundtrip: failed to decode JSON array: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,102 @@
+package roundtrip
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+// jsonArrayServer answers with body one byte per read, counting how much
+// of it was read in body
+func jsonArrayServer(body string) (*MockTransport, *countingReader) {
+	counter := &countingReader{r: iotest.OneByteReader(strings.NewReader(body))}
+	return &MockTransport{
+		Handler: func(request *http.Request) (*http.Response, error) {
+			response := MockResponse(request, http.StatusOK, body)
+			response.Header.Set("Content-Type", "application/json")
+			response.Body = io.NopCloser(counter)
+			return response, nil
+		},
+	}, counter
+}
+
+type item struct {
+	Id int
+}
+
+func TestGetJSONStream(t *testing.T) {
+	const body = `[{"Id":1}, {"Id":2}, {"Id":3}]`
+	transport, counter := jsonArrayServer(body)
+
+	var ids []int
+	var readAt []int
+	count, err := GetJSONStream(&http.Client{Transport: transport}, "http://example.com/items", func(i item) error {
+		ids = append(ids, i.Id)
+		readAt = append(readAt, counter.read)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Fatalf("count = %d, ids = %v, want 1, 2 and 3", count, ids)
+	}
+	for i, read := range readAt {
+		if read >= len(body) {
+			t.Errorf("element %d was passed on after the whole body was read", i)
+		}
+	}
+	if requests := transport.Requests(); len(requests) != 1 || requests[0].Header.Get("Accept") != "application/json" {
+		t.Errorf("requests = %+v, want one GET accepting JSON", requests)
+	}
+}
+
+func TestGetJSONStreamStopsOnItemError(t *testing.T) {
+	const body = `[{"Id":1}, {"Id":2}, {"Id":3}]`
+	transport, counter := jsonArrayServer(body)
+	stop := errors.New("enough")
+
+	var ids []int
+	count, err := GetJSONStream(&http.Client{Transport: transport}, "http://example.com/items", func(i item) error {
+		ids = append(ids, i.Id)
+		if i.Id == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("err = %v, want the onItem error as is", err)
+	}
+	if count != 2 || len(ids) != 2 {
+		t.Errorf("count = %d, ids = %v, want to stop after the second element", count, ids)
+	}
+	if counter.read >= len(body) {
+		t.Error("the rest of the body was read after onItem failed")
+	}
+}
+
+func TestGetJSONStreamNotAnArray(t *testing.T) {
+	transport, _ := jsonArrayServer(`{"Id":1}`)
+	_, err := GetJSONStream(&http.Client{Transport: transport}, "http://example.com/items", func(item) error {
+		t.Error("onItem called for an object")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "expected a JSON array") {
+		t.Errorf("err = %v, want a JSON array error", err)
+	}
+}
@@ -0,0 +1,137 @@
+package roundtrip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const defaultMaxDumpBody = 1024
+
+// LoggingTransport wraps another RoundTripper and passes a dump of each
+// request and response, including headers and a truncated body, to Tap.
+//
+// Bodies are teed while they are streamed instead of being read upfront, so
+// Tap is called once the response body has been read to the end or closed.
+type LoggingTransport struct {
+	// Base is the transport doing the actual work, WasiHttpTransport if nil
+	Base http.RoundTripper
+	// Tap receives the dumps of every round trip
+	Tap func(reqDump, respDump []byte)
+	// MaxBody is the number of body bytes kept in a dump, 1024 if zero
+	MaxBody int
+}
+
+func (t LoggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = WasiHttpTransport{}
+	}
+	limit := t.MaxBody
+	if limit <= 0 {
+		limit = defaultMaxDumpBody
+	}
+
+	requestBody := &dumpBuffer{limit: limit}
+	if request.Body != nil {
+		body := request.Body
+		request = request.Clone(request.Context())
+		request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, requestBody), body}
+	}
+
+	response, err := base.RoundTrip(request)
+	requestDump := dumpRequest(request, requestBody)
+	if err != nil {
+		t.tap(requestDump, []byte(fmt.Sprintf("error: %v\n", err)))
+		return nil, err
+	}
+
+	responseBody := &dumpBuffer{limit: limit}
+	response.Body = &tappedBody{
+		body:   response.Body,
+		reader: io.TeeReader(response.Body, responseBody),
+		done: func() {
+			t.tap(requestDump, dumpResponse(response, responseBody))
+		},
+	}
+	return response, nil
+}
+
+func (t LoggingTransport) tap(requestDump []byte, responseDump []byte) {
+	if t.Tap != nil {
+		t.Tap(requestDump, responseDump)
+	}
+}
+
+func dumpRequest(request *http.Request, body *dumpBuffer) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", request.Method, request.URL.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", request.URL.Host)
+	request.Header.Write(&b)
+	b.WriteString("\r\n")
+	body.writeTo(&b)
+	return b.Bytes()
+}
+
+func dumpResponse(response *http.Response, body *dumpBuffer) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", response.Status)
+	response.Header.Write(&b)
+	b.WriteString("\r\n")
+	body.writeTo(&b)
+	return b.Bytes()
+}
+
+// dumpBuffer keeps the first limit bytes written to it and discards the rest
+type dumpBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (d *dumpBuffer) Write(p []byte) (int, error) {
+	room := d.limit - d.buf.Len()
+	if room < len(p) {
+		d.truncated = true
+		if room > 0 {
+			d.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	d.buf.Write(p)
+	return len(p), nil
+}
+
+func (d *dumpBuffer) writeTo(w io.Writer) {
+	w.Write(d.buf.Bytes())
+	if d.truncated {
+		io.WriteString(w, "\n[truncated]")
+	}
+}
+
+// tappedBody reports the end of the response body exactly once, either on
+// EOF or on Close
+type tappedBody struct {
+	body   io.ReadCloser
+	reader io.Reader
+	done   func()
+	once   sync.Once
+}
+
+func (b *tappedBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *tappedBody) Close() error {
+	b.once.Do(b.done)
+	return b.body.Close()
+}
@@ -0,0 +1,82 @@
+package roundtrip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MockTransport is a http.RoundTripper for tests that answers requests with
+// Handler instead of sending them, and records every request it sees. It
+// can take the place of WasiHttpTransport in an http.Client and does not
+// need a WASI host.
+type MockTransport struct {
+	// Handler answers the requests, an empty 200 response is sent if nil
+	Handler func(*http.Request) (*http.Response, error)
+
+	mu       sync.Mutex
+	requests []RecordedRequest
+}
+
+// RecordedRequest is a request seen by MockTransport, with its body read
+type RecordedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+func (t *MockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.requests = append(t.requests, RecordedRequest{
+		Method: request.Method,
+		URL:    request.URL.String(),
+		Header: request.Header.Clone(),
+		Body:   body,
+	})
+	t.mu.Unlock()
+
+	if t.Handler == nil {
+		return MockResponse(request, http.StatusOK, ""), nil
+	}
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return t.Handler(request)
+}
+
+// Requests returns the requests seen so far, oldest first
+func (t *MockTransport) Requests() []RecordedRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedRequest(nil), t.requests...)
+}
+
+// MockResponse builds a response to request with the given status and body,
+// for use in MockTransport handlers
+func MockResponse(request *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,54 @@
+package roundtrip
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GetStreaming sends a GET request for url with client and reads the
+// response body as it arrives, calling onChunk with the size of each chunk
+// read from the incoming body stream. A nil client sends the request
+// through WasiHttpTransport. It returns the total number of bytes read. The
+// body itself is discarded, so GetStreaming is meant for tracking the
+// progress of downloads whose size matters more than their content, or as
+// a model for readers that keep the data.
+func GetStreaming(client *http.Client, url string, onChunk func(n int)) (int64, error) {
+	client = orWasiClient(client)
+	response, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return 0, fmt.Errorf("roundtrip: GET %s failed with status %s", url, response.Status)
+	}
+
+	var total int64
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := response.Body.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			onChunk(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// orWasiClient returns client, or a client sending its requests through
+// WasiHttpTransport if client is nil
+func orWasiClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{
+		Transport: WasiHttpTransport{},
+	}
+}
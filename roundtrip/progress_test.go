@@ -0,0 +1,63 @@
+package roundtrip
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkedServer answers every request with body, handed out one byte per
+// read like a body arriving over the network
+func chunkedServer(body string) *MockTransport {
+	return &MockTransport{
+		Handler: func(request *http.Request) (*http.Response, error) {
+			response := MockResponse(request, http.StatusOK, body)
+			response.Body = io.NopCloser(iotest.OneByteReader(strings.NewReader(body)))
+			return response, nil
+		},
+	}
+}
+
+func TestGetStreaming(t *testing.T) {
+	const body = "0123456789abcdef"
+	transport := chunkedServer(body)
+
+	var chunks []int
+	total, err := GetStreaming(&http.Client{Transport: transport}, "http://example.com/download", func(n int) {
+		chunks = append(chunks, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != int64(len(body)) {
+		t.Errorf("total = %d, want %d", total, len(body))
+	}
+	if len(chunks) < 2 {
+		t.Errorf("onChunk called with %v, want a call per chunk", chunks)
+	}
+	sum := 0
+	for _, n := range chunks {
+		sum += n
+	}
+	if sum != len(body) {
+		t.Errorf("chunks %v add up to %d, want %d", chunks, sum, len(body))
+	}
+}
+
+func TestGetStreamingStatus(t *testing.T) {
+	transport := &MockTransport{
+		Handler: func(request *http.Request) (*http.Response, error) {
+			return MockResponse(request, http.StatusNotFound, "missing"), nil
+		},
+	}
+	called := false
+	_, err := GetStreaming(&http.Client{Transport: transport}, "http://example.com/download", func(int) { called = true })
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want the 404 status", err)
+	}
+	if called {
+		t.Error("onChunk was called for an error response")
+	}
+}
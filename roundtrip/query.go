@@ -0,0 +1,27 @@
+package roundtrip
+
+import (
+	"net/url"
+)
+
+// WithQuery returns baseURL with params added to its query string. The
+// query already in baseURL is kept verbatim, in its order and with its
+// separators; params are escaped and appended after it, sorted by key.
+// Parameters present in both are therefore sent twice rather than
+// replaced.
+func WithQuery(baseURL string, params url.Values) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if len(params) == 0 {
+		return u.String(), nil
+	}
+
+	if u.RawQuery == "" {
+		u.RawQuery = params.Encode()
+	} else {
+		u.RawQuery += "&" + params.Encode()
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,42 @@
+package roundtrip
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestWithQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		params  url.Values
+		want    string
+	}{
+		{"no params", "http://example.com/path?a=1", nil, "http://example.com/path?a=1"},
+		{"no base query", "http://example.com/path", url.Values{"q": {"x"}}, "http://example.com/path?q=x"},
+		{"escaping", "http://example.com/", url.Values{"q": {"a b&c=d/é"}}, "http://example.com/?q=a+b%26c%3Dd%2F%C3%A9"},
+		{"escaped key", "http://example.com/", url.Values{"a&b": {"1"}}, "http://example.com/?a%26b=1"},
+		{"merge keeps the base order", "http://example.com/?z=1&a=2", url.Values{"m": {"3"}}, "http://example.com/?z=1&a=2&m=3"},
+		{"repeated key", "http://example.com/?a=1", url.Values{"a": {"2", "3"}}, "http://example.com/?a=1&a=2&a=3"},
+		{"params sorted", "http://example.com/", url.Values{"b": {"2"}, "a": {"1"}}, "http://example.com/?a=1&b=2"},
+		{"semicolons kept", "http://example.com/?a=1;b=2", url.Values{"c": {"3"}}, "http://example.com/?a=1;b=2&c=3"},
+		{"fragment kept", "http://example.com/?a=1#top", url.Values{"b": {"2"}}, "http://example.com/?a=1&b=2#top"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := WithQuery(test.baseURL, test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("WithQuery = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWithQueryInvalidURL(t *testing.T) {
+	if _, err := WithQuery("http://exa mple.com/%zz", url.Values{"a": {"1"}}); err == nil {
+		t.Fatal("expected an error for an invalid base URL")
+	}
+}
@@ -0,0 +1,97 @@
+package roundtrip
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitedTransport wraps another RoundTripper with a token bucket
+// letting through rps requests per second on average and bursts of up to
+// burst requests. A request finding the bucket empty waits for its token
+// before it is sent.
+type RateLimitedTransport struct {
+	// Now returns the current time, clock.Now inside a WASI host and
+	// time.Now outside of one if nil
+	Now func() time.Time
+
+	base  http.RoundTripper
+	rps   float64
+	burst float64
+
+	mu      sync.Mutex
+	started bool
+	tokens  float64
+	last    time.Time
+}
+
+// RateLimited wraps base, WasiHttpTransport if nil, in a
+// RateLimitedTransport. A burst below one is taken as one, so requests
+// still go through one at a time; an rps of zero or less disables the
+// limit.
+func RateLimited(base http.RoundTripper, rps float64, burst int) *RateLimitedTransport {
+	if base == nil {
+		base = WasiHttpTransport{}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimitedTransport{
+		base:  base,
+		rps:   rps,
+		burst: float64(burst),
+	}
+}
+
+func (t *RateLimitedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.rps > 0 {
+		if err := t.wait(request.Context()); err != nil {
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(request)
+}
+
+// wait takes a token, sleeping until it is available. The token is reserved
+// before sleeping, so concurrent requests queue up behind each other
+// instead of competing for the same token.
+func (t *RateLimitedTransport) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := t.now()
+	if !t.started {
+		t.started = true
+		t.tokens = t.burst
+	} else {
+		t.tokens += now.Sub(t.last).Seconds() * t.rps
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+	}
+	t.last = now
+	t.tokens--
+	var delay time.Duration
+	if t.tokens < 0 {
+		delay = time.Duration(-t.tokens / t.rps * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		t.mu.Lock()
+		t.tokens++
+		t.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	sleep(delay)
+	return nil
+}
+
+func (t *RateLimitedTransport) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return durableNow()
+}
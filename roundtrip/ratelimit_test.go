@@ -0,0 +1,75 @@
+package roundtrip
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func sendAll(t *testing.T, transport http.RoundTripper, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+}
+
+func TestRateLimitedSpacesRequests(t *testing.T) {
+	server := &MockTransport{}
+	transport := RateLimited(server, 50, 2)
+
+	// The burst goes through at once, each of the other 4 requests waits
+	// 1/50s for its token
+	start := time.Now()
+	sendAll(t, transport, 6)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("6 requests took %v, want at least 80ms", elapsed)
+	}
+	if got := len(server.Requests()); got != 6 {
+		t.Fatalf("%d requests sent, want 6", got)
+	}
+}
+
+func TestRateLimitedZeroBurst(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		sendAll(t, RateLimited(&MockTransport{}, 1000, 0), 3)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("requests with a zero burst did not go through")
+	}
+}
+
+func TestRateLimitedWithoutRate(t *testing.T) {
+	transport := RateLimited(&MockTransport{}, 0, 0)
+	transport.Now = func() time.Time {
+		t.Fatal("the clock was read without a rate limit")
+		return time.Time{}
+	}
+	sendAll(t, transport, 10)
+}
+
+func TestRateLimitedUsesNow(t *testing.T) {
+	// A day ahead, so that the real clock would find the deadline far away
+	at := time.Now().Add(24 * time.Hour)
+	transport := RateLimited(&MockTransport{}, 1, 1)
+	transport.Now = func() time.Time { return at }
+	sendAll(t, transport, 1)
+
+	// The clock does not move, so the next token is a second away and past
+	// the deadline
+	ctx, cancel := context.WithDeadline(context.Background(), at.Add(500*time.Millisecond))
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+	if _, err := transport.RoundTrip(request); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,97 @@
+package roundtrip
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+// RetryPolicy controls how WasiHttpTransport retries requests the server
+// answered with 429 Too Many Requests or 503 Service Unavailable.
+//
+// The delay before a retry is the one asked by the server's Retry-After
+// header, in either its delta-seconds or HTTP-date form. Without a usable
+// Retry-After the delay doubles from BaseDelay on every attempt. Either way
+// it never exceeds MaxDelay, so a server cannot pin the worker.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, 500ms if zero
+	BaseDelay time.Duration
+	// MaxDelay caps every delay, 30s if zero
+	MaxDelay time.Duration
+}
+
+func (p RetryPolicy) delay(attempt int, retryAfter string, now time.Time) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	delay, ok := parseRetryAfter(retryAfter, now)
+	if !ok {
+		delay = p.backoff(attempt, maxDelay)
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func (p RetryPolicy) backoff(attempt int, maxDelay time.Duration) time.Duration {
+	delay := p.BaseDelay
+	if delay <= 0 {
+		delay = defaultRetryBaseDelay
+	}
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header, see RFC 9110 section 10.2.3
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// rewindBody returns a copy of request with a fresh body for resending it
+func rewindBody(request *http.Request) (*http.Request, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return request, nil
+	}
+	if request.GetBody == nil {
+		return nil, errors.New("roundtrip: cannot resend a request body without GetBody")
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry := request.Clone(request.Context())
+	retry.Body = body
+	return retry, nil
+}
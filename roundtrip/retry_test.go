@@ -0,0 +1,49 @@
+package roundtrip
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  time.Second,
+		MaxDelay:   time.Minute,
+	}
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		want       time.Duration
+	}{
+		{"delta-seconds", 0, "7", 7 * time.Second},
+		{"HTTP-date", 0, now.Add(20 * time.Second).Format(http.TimeFormat), 20 * time.Second},
+		{"past HTTP-date", 0, now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		{"no header", 0, "", time.Second},
+		{"garbage falls back to backoff", 2, "soon", 4 * time.Second},
+		{"negative seconds fall back to backoff", 1, "-5", 2 * time.Second},
+		{"delta-seconds capped", 0, "3600", time.Minute},
+		{"HTTP-date capped", 0, now.Add(time.Hour).Format(http.TimeFormat), time.Minute},
+		{"backoff capped", 10, "", time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.delay(test.attempt, test.retryAfter, now); got != test.want {
+				t.Fatalf("delay = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	var policy RetryPolicy
+	if got := policy.delay(0, "", time.Now()); got != defaultRetryBaseDelay {
+		t.Fatalf("first delay = %v, want %v", got, defaultRetryBaseDelay)
+	}
+	if got := policy.delay(0, "86400", time.Now()); got != defaultRetryMaxDelay {
+		t.Fatalf("capped delay = %v, want %v", got, defaultRetryMaxDelay)
+	}
+}
@@ -1,23 +1,65 @@
+//go:build tinygo.wasm
+
 package roundtrip
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"golem/template/clock"
 	go_wasi_http "golem/template/gogolem_test"
 )
 
-type WasiHttpTransport struct {
+func (t WasiHttpTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.send(request)
+	if t.RetryPolicy == nil {
+		return response, err
+	}
+
+	for attempt := 0; err == nil && attempt < t.RetryPolicy.MaxRetries && isRetryableStatus(response.StatusCode); attempt++ {
+		now := clock.Now()
+		delay := t.RetryPolicy.delay(attempt, response.Header.Get("Retry-After"), now)
+		if deadline, ok := request.Context().Deadline(); ok && now.Add(delay).After(deadline) {
+			break
+		}
+		retry, rewindErr := rewindBody(request)
+		if rewindErr != nil {
+			break
+		}
+
+		response.Body.Close()
+		sleep(delay)
+		response, err = t.send(retry)
+	}
+	return response, err
 }
 
-func (t WasiHttpTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+func (t WasiHttpTransport) send(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		// The body is closed exactly once, whichever way send returns
+		defer request.Body.Close()
+	}
+
+	start := go_wasi_http.WasiClocksMonotonicClockNow()
+	timing := &Timing{}
 
+	proxyUrl, err := t.proxyFor(request)
+	if err != nil {
+		return nil, err
+	}
+
+	outgoing, err := outgoingHeaders(request, proxyUrl)
+	if err != nil {
+		return nil, err
+	}
 	var headerKeyValues []go_wasi_http.WasiHttpTypesTuple2StringStringT
-	for key, values := range request.Header {
+	for key, values := range outgoing {
 		for _, value := range values {
 			headerKeyValues = append(headerKeyValues, go_wasi_http.WasiHttpTypesTuple2StringStringT{
 				F0: key,
@@ -28,112 +70,90 @@ func (t WasiHttpTransport) RoundTrip(request *http.Request) (*http.Response, err
 	headers := go_wasi_http.WasiHttpTypesNewFields(headerKeyValues)
 	defer go_wasi_http.WasiHttpTypesDropFields(headers)
 
-	var method go_wasi_http.WasiHttpTypesMethod
-	switch strings.ToUpper(request.Method) {
-	case "":
-		method = go_wasi_http.WasiHttpTypesMethodGet()
-	case "GET":
-		method = go_wasi_http.WasiHttpTypesMethodGet()
-	case "HEAD":
-		method = go_wasi_http.WasiHttpTypesMethodHead()
-	case "POST":
-		method = go_wasi_http.WasiHttpTypesMethodPost()
-	case "PUT":
-		method = go_wasi_http.WasiHttpTypesMethodPut()
-	case "DELETE":
-		method = go_wasi_http.WasiHttpTypesMethodDelete()
-	case "CONNECT":
-		method = go_wasi_http.WasiHttpTypesMethodConnect()
-	case "OPTIONS":
-		method = go_wasi_http.WasiHttpTypesMethodOptions()
-	case "TRACE":
-		method = go_wasi_http.WasiHttpTypesMethodTrace()
-	case "PATCH":
-		method = go_wasi_http.WasiHttpTypesMethodPatch()
-	default:
-		method = go_wasi_http.WasiHttpTypesMethodOther(request.Method)
-	}
-
-	path := request.URL.Path
-	query := request.URL.RawQuery
-	pathAndQuery := path
-	if query != "" {
-		pathAndQuery += "?" + query
-	}
-
-	var scheme go_wasi_http.WasiHttpTypesScheme
-	switch strings.ToLower(request.URL.Scheme) {
-	case "http":
-		scheme = go_wasi_http.WasiHttpTypesSchemeHttp()
-	case "https":
-		scheme = go_wasi_http.WasiHttpTypesSchemeHttps()
-	default:
-		scheme = go_wasi_http.WasiHttpTypesSchemeOther(request.URL.Scheme)
+	method, err := wasiMethod(request.Method)
+	if err != nil {
+		return nil, err
 	}
 
-	userPassword := request.URL.User.String()
-	var authority string
-	if userPassword == "" {
-		authority = request.URL.Host
-	} else {
-		authority = userPassword + "@" + request.URL.Host
-	}
+	scheme, authority, pathAndQuery := requestTarget(request, proxyUrl)
 
 	requestHandle := go_wasi_http.WasiHttpTypesNewOutgoingRequest(
 		method,
 		go_wasi_http.Some[string](pathAndQuery),
-		go_wasi_http.Some[go_wasi_http.WasiHttpTypesScheme](scheme),
+		go_wasi_http.Some[go_wasi_http.WasiHttpTypesScheme](wasiScheme(scheme)),
 		go_wasi_http.Some[string](authority),
 		headers,
 	)
 	defer go_wasi_http.WasiHttpTypesDropOutgoingRequest(requestHandle)
 
-	if request.Body != nil {
-		reader := request.Body
-		defer reader.Close()
+	// The timeout bounds the whole request, up to the end of the response
+	// body. The host phases get the time left as their own timeouts, so
+	// the host gives up as well, but it is the deadline that ends waiting
+	// for the response and for body chunks. It is checked before the body
+	// stream is opened, so an expired request leaves no stream behind.
+	var deadline uint64
+	connectTimeoutMs := go_wasi_http.None[uint32]()
+	firstByteTimeoutMs := go_wasi_http.None[uint32]()
+	betweenBytesTimeoutMs := go_wasi_http.None[uint32]()
+	if timeout, ok := t.timeoutFor(request); ok {
+		ms, ok := timeoutMillis(timeout)
+		if !ok {
+			return nil, context.DeadlineExceeded
+		}
+		deadline = go_wasi_http.WasiClocksMonotonicClockNow() + uint64(timeout.Nanoseconds())
+		timeoutMs := go_wasi_http.Some[uint32](ms)
+		connectTimeoutMs = timeoutMs
+		firstByteTimeoutMs = timeoutMs
+		betweenBytesTimeoutMs = timeoutMs
+	}
+	options := go_wasi_http.WasiHttpTypesRequestOptions{
+		ConnectTimeoutMs:      connectTimeoutMs,
+		FirstByteTimeoutMs:    firstByteTimeoutMs,
+		BetweenBytesTimeoutMs: betweenBytesTimeoutMs,
+	}
 
+	// A body of known length is written before the request is handed to
+	// the host. A body of unknown length is streamed after it, so the host
+	// can send each chunk as soon as it is written instead of waiting for
+	// the end of the body.
+	var requestBody uint32
+	if request.Body != nil {
 		requestBodyResult := go_wasi_http.WasiHttpTypesOutgoingRequestWrite(requestHandle)
 		if requestBodyResult.IsErr() {
 			return nil, errors.New("Failed to start writing request body")
 		}
-		requestBody := requestBodyResult.Unwrap()
-
-		buffer := make([]byte, 1024)
-		for {
-			n, err := reader.Read(buffer)
-
-			result := go_wasi_http.WasiIoStreamsWrite(requestBody, buffer[:n])
-			if result.IsErr() {
-				go_wasi_http.WasiIoStreamsDropOutputStream(requestBody)
-				return nil, errors.New("Failed to write request body chunk")
-			}
+		requestBody = requestBodyResult.Unwrap()
 
-			if err == io.EOF {
-				break
+		if !isChunked(request) {
+			if err := writeBody(requestBody, request.Body); err != nil {
+				return nil, err
 			}
 		}
-
-		go_wasi_http.WasiHttpTypesFinishOutgoingStream(requestBody, go_wasi_http.None[uint32]())
-		go_wasi_http.WasiIoStreamsDropOutputStream(requestBody)
-	}
-
-	// TODO: timeouts
-	connectTimeoutMs := go_wasi_http.None[uint32]()
-	firstByteTimeoutMs := go_wasi_http.None[uint32]()
-	betweenBytesTimeoutMs := go_wasi_http.None[uint32]()
-	options := go_wasi_http.WasiHttpTypesRequestOptions{
-		ConnectTimeoutMs:      connectTimeoutMs,
-		FirstByteTimeoutMs:    firstByteTimeoutMs,
-		BetweenBytesTimeoutMs: betweenBytesTimeoutMs,
 	}
 
 	future := go_wasi_http.WasiHttpOutgoingHandlerHandle(requestHandle, go_wasi_http.Some(options))
 	defer go_wasi_http.WasiHttpTypesDropFutureIncomingResponse(future)
 
-	incomingResponse, err := GetIncomingResponse(future)
+	if isChunked(request) {
+		if err := writeBody(requestBody, request.Body); err != nil {
+			return nil, err
+		}
+	}
+	timing.Sent = elapsedSince(start)
+
+	incomingResponse, err := awaitIncomingResponse(future, deadline)
 	if err != nil {
 		return nil, err
 	}
+	// The incoming response is dropped here unless its body is returned,
+	// in which case closing the body drops it
+	keepResponse := false
+	defer func() {
+		if !keepResponse {
+			go_wasi_http.WasiHttpTypesDropIncomingResponse(incomingResponse)
+		}
+	}()
+	timing.FirstByte = elapsedSince(start)
 
 	status := go_wasi_http.WasiHttpTypesIncomingResponseStatus(incomingResponse)
 	responseHeaders := go_wasi_http.WasiHttpTypesIncomingResponseHeaders(incomingResponse)
@@ -166,58 +186,263 @@ func (t WasiHttpTransport) RoundTrip(request *http.Request) (*http.Response, err
 		contentLength = -1
 	}
 
+	response := http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(int(status))),
+		StatusCode:    int(status),
+		Header:        header,
+		ContentLength: contentLength,
+		Request:       withTiming(request, timing),
+	}
+
+	// A response to HEAD has no body even when it declares a Content-Length,
+	// so the body stream is not consumed and nothing waits for bytes that
+	// never come
+	if request.Method == http.MethodHead {
+		timing.Complete = timing.FirstByte
+		response.Body = http.NoBody
+		return &response, nil
+	}
+
 	responseBodyStreamResult := go_wasi_http.WasiHttpTypesIncomingResponseConsume(incomingResponse)
 	if responseBodyStreamResult.IsErr() {
 		return nil, errors.New("Failed to consume response body")
 	}
 	responseBodyStream := responseBodyStreamResult.Unwrap()
 
-	responseReader := WasiStreamReader{
-		Handle: responseBodyStream,
+	response.Body = countBody(newWasiStreamReader(responseBodyStream, incomingResponse, deadline, start, timing))
+	keepResponse = true
+
+	return &response, nil
+}
+
+// wasiMethod maps a request method to the wasi:http method variant, see
+// methodCase
+func wasiMethod(method string) (go_wasi_http.WasiHttpTypesMethod, error) {
+	name, other, err := methodCase(method)
+	if err != nil {
+		return go_wasi_http.WasiHttpTypesMethod{}, err
+	}
+	if other {
+		return go_wasi_http.WasiHttpTypesMethodOther(name), nil
+	}
+	switch name {
+	case http.MethodHead:
+		return go_wasi_http.WasiHttpTypesMethodHead(), nil
+	case http.MethodPost:
+		return go_wasi_http.WasiHttpTypesMethodPost(), nil
+	case http.MethodPut:
+		return go_wasi_http.WasiHttpTypesMethodPut(), nil
+	case http.MethodDelete:
+		return go_wasi_http.WasiHttpTypesMethodDelete(), nil
+	case http.MethodConnect:
+		return go_wasi_http.WasiHttpTypesMethodConnect(), nil
+	case http.MethodOptions:
+		return go_wasi_http.WasiHttpTypesMethodOptions(), nil
+	case http.MethodTrace:
+		return go_wasi_http.WasiHttpTypesMethodTrace(), nil
+	case http.MethodPatch:
+		return go_wasi_http.WasiHttpTypesMethodPatch(), nil
+	default:
+		return go_wasi_http.WasiHttpTypesMethodGet(), nil
 	}
+}
 
-	response := http.Response{
-		Status:        fmt.Sprintf("%d %s", status, http.StatusText(int(status))),
-		StatusCode:    int(status),
-		Header:        header,
-		ContentLength: contentLength,
-		Body:          responseReader,
-		Request:       request,
+// writeBody copies body to the outgoing stream as it is read, then finishes
+// and drops the stream
+func writeBody(requestBody uint32, body io.Reader) error {
+	defer go_wasi_http.WasiIoStreamsDropOutputStream(requestBody)
+
+	buffer := make([]byte, 1024)
+	for {
+		n, err := body.Read(buffer)
+
+		if n > 0 {
+			if err := writeStream(requestBody, buffer[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read request body: %w", err)
+		}
 	}
 
-	return &response, nil
+	go_wasi_http.WasiHttpTypesFinishOutgoingStream(requestBody, go_wasi_http.None[uint32]())
+	return nil
+}
+
+// writeStream writes all of p to stream. The stream may accept only part of
+// a write when its buffer is full, so the rest is written once polling the
+// stream reports room for more.
+func writeStream(stream uint32, p []byte) error {
+	for len(p) > 0 {
+		result := go_wasi_http.WasiIoStreamsWrite(stream, p)
+		if result.IsErr() {
+			return errors.New("Failed to write request body chunk")
+		}
+		tuple := result.Unwrap()
+		p = p[tuple.F0:]
+		if len(p) == 0 {
+			break
+		}
+		if tuple.F1 == go_wasi_http.WasiIoStreamsStreamStatusEnded() {
+			return errors.New("Request body stream closed before the whole body was written")
+		}
+		if tuple.F0 == 0 {
+			pollable := go_wasi_http.WasiIoStreamsSubscribeToOutputStream(stream)
+			go_wasi_http.WasiPollPollPollOneoff([]uint32{pollable})
+			go_wasi_http.WasiPollPollDropPollable(pollable)
+		}
+	}
+	return nil
+}
+
+func wasiScheme(scheme string) go_wasi_http.WasiHttpTypesScheme {
+	switch strings.ToLower(scheme) {
+	case "http":
+		return go_wasi_http.WasiHttpTypesSchemeHttp()
+	case "https":
+		return go_wasi_http.WasiHttpTypesSchemeHttps()
+	default:
+		return go_wasi_http.WasiHttpTypesSchemeOther(scheme)
+	}
 }
 
 func GetIncomingResponse(future uint32) (uint32, error) {
-	result := go_wasi_http.WasiHttpTypesFutureIncomingResponseGet(future)
-	if result.IsSome() {
-		result2 := result.Unwrap()
-		if result2.IsErr() {
-			return 0, errors.New("Failed to send request")
+	return awaitIncomingResponse(future, 0)
+}
+
+// awaitIncomingResponse waits for the response to a request, giving up at
+// the monotonic deadline unless it is zero
+func awaitIncomingResponse(future uint32, deadline uint64) (uint32, error) {
+	for {
+		result := go_wasi_http.WasiHttpTypesFutureIncomingResponseGet(future)
+		if result.IsSome() {
+			result2 := result.Unwrap()
+			if result2.IsErr() {
+				return 0, wasiError(result2.UnwrapErr())
+			}
+			return result2.Unwrap(), nil
 		}
-		return result2.Unwrap(), nil
-	} else {
 		pollable := go_wasi_http.WasiHttpTypesListenToFutureIncomingResponse(future)
-		var pollables []uint32
-		pollables = append(pollables, pollable)
-		go_wasi_http.WasiPollPollPollOneoff(pollables)
+		ready := await(pollable, deadline)
 		go_wasi_http.WasiPollPollDropPollable(pollable)
-		return GetIncomingResponse(future)
+		if !ready {
+			return 0, context.DeadlineExceeded
+		}
+	}
+}
+
+// await blocks until pollable is ready or, unless it is zero, the monotonic
+// deadline has passed, and reports whether pollable is ready
+func await(pollable uint32, deadline uint64) bool {
+	if deadline == 0 {
+		go_wasi_http.WasiPollPollPollOneoff([]uint32{pollable})
+		return true
+	}
+	timer := go_wasi_http.WasiClocksMonotonicClockSubscribe(deadline, true)
+	defer go_wasi_http.WasiPollPollDropPollable(timer)
+	return go_wasi_http.WasiPollPollPollOneoff([]uint32{pollable, timer})[0]
+}
+
+// sleep waits for d on the monotonic clock, which Golem persists in the
+// oplog so a replayed worker does not wait again
+func sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	pollable := go_wasi_http.WasiClocksMonotonicClockSubscribe(uint64(d.Nanoseconds()), false)
+	go_wasi_http.WasiPollPollPollOneoff([]uint32{pollable})
+	go_wasi_http.WasiPollPollDropPollable(pollable)
+}
+
+func durableNow() time.Time {
+	return clock.Now()
+}
+
+func elapsedSince(start uint64) time.Duration {
+	return time.Duration(go_wasi_http.WasiClocksMonotonicClockNow() - start)
+}
+
+func wasiError(err go_wasi_http.WasiHttpTypesError) *Error {
+	switch err.Kind() {
+	case go_wasi_http.WasiHttpTypesErrorKindInvalidUrl:
+		return newWasiError("invalid-url", err.GetInvalidUrl())
+	case go_wasi_http.WasiHttpTypesErrorKindTimeoutError:
+		return newWasiError("timeout-error", err.GetTimeoutError())
+	case go_wasi_http.WasiHttpTypesErrorKindProtocolError:
+		return newWasiError("protocol-error", err.GetProtocolError())
+	default:
+		return newWasiError("unexpected-error", err.GetUnexpectedError())
 	}
 }
 
+// WasiStreamReader reads an incoming body stream. Closing it drops the
+// stream and, for the body of a response received by WasiHttpTransport, the
+// incoming response it belongs to, whether or not the body was read to its
+// end.
 type WasiStreamReader struct {
 	Handle uint32
+
+	response    uint32
+	ownResponse bool
+	closed      bool
+	// deadline is the monotonic time reads fail at, none if zero
+	deadline uint64
+	start    uint64
+	timing   *Timing
 }
 
-func (reader WasiStreamReader) Read(p []byte) (int, error) {
-	c := cap(p)
-	result := go_wasi_http.WasiIoStreamsRead(reader.Handle, uint64(c))
+func newWasiStreamReader(stream uint32, response uint32, deadline uint64, start uint64, timing *Timing) *WasiStreamReader {
+	return &WasiStreamReader{
+		Handle:      stream,
+		response:    response,
+		ownResponse: true,
+		deadline:    deadline,
+		start:       start,
+		timing:      timing,
+	}
+}
+
+// complete records the end of the body the first time it is reached
+func (reader *WasiStreamReader) complete() {
+	if reader.timing != nil && reader.timing.Complete == 0 {
+		reader.timing.Complete = elapsedSince(reader.start)
+	}
+}
+
+func (reader *WasiStreamReader) Read(p []byte) (int, error) {
+	if reader.closed {
+		return 0, errors.New("Read on closed response body")
+	}
+	if reader.deadline != 0 && go_wasi_http.WasiClocksMonotonicClockNow() >= reader.deadline {
+		return 0, context.DeadlineExceeded
+	}
+	result := go_wasi_http.WasiIoStreamsRead(reader.Handle, uint64(len(p)))
 	if result.IsErr() {
 		return 0, errors.New("Failed to read response stream")
 	}
 
 	tuple := result.Unwrap()
+	// The stream returns no bytes when none have arrived yet, wait for some
+	// instead of handing the caller an empty read
+	for len(tuple.F0) == 0 && len(p) > 0 && tuple.F1 != go_wasi_http.WasiIoStreamsStreamStatusEnded() {
+		pollable := go_wasi_http.WasiIoStreamsSubscribeToInputStream(reader.Handle)
+		ready := await(pollable, reader.deadline)
+		go_wasi_http.WasiPollPollDropPollable(pollable)
+		if !ready {
+			return 0, context.DeadlineExceeded
+		}
+		result = go_wasi_http.WasiIoStreamsRead(reader.Handle, uint64(len(p)))
+		if result.IsErr() {
+			return 0, errors.New("Failed to read response stream")
+		}
+		tuple = result.Unwrap()
+	}
+
 	var err error
 	if tuple.F1 == go_wasi_http.WasiIoStreamsStreamStatusEnded() {
 		err = io.EOF
@@ -225,12 +450,24 @@ func (reader WasiStreamReader) Read(p []byte) (int, error) {
 		err = nil
 	}
 
+	if err == io.EOF {
+		reader.complete()
+	}
+
 	chunk := tuple.F0
 	copy(p, chunk)
 	return len(chunk), err
 }
 
-func (reader WasiStreamReader) Close() error {
+func (reader *WasiStreamReader) Close() error {
+	if reader.closed {
+		return nil
+	}
+	reader.closed = true
+	reader.complete()
 	go_wasi_http.WasiIoStreamsDropInputStream(reader.Handle)
+	if reader.ownResponse {
+		go_wasi_http.WasiHttpTypesDropIncomingResponse(reader.response)
+	}
 	return nil
 }
@@ -0,0 +1,23 @@
+//go:build !tinygo.wasm
+
+package roundtrip
+
+import (
+	"net/http"
+	"time"
+)
+
+func (t WasiHttpTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	return nil, ErrNoWasiHost
+}
+
+func sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func durableNow() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,18 @@
+//go:build !tinygo.wasm
+
+package roundtrip
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripOutsideWasiHost(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	_, err := WasiHttpTransport{}.RoundTrip(request)
+	if !errors.Is(err, ErrNoWasiHost) || !strings.Contains(err.Error(), "Install()") {
+		t.Fatalf("err = %v, want ErrNoWasiHost mentioning Install()", err)
+	}
+}
@@ -0,0 +1,42 @@
+package roundtrip
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timing holds the phases of a request made by WasiHttpTransport, measured
+// with the wasi monotonic clock (which Golem persists in the oplog) from the
+// start of RoundTrip.
+//
+// wasi:http does not report when the connection is established, so Sent,
+// the moment the request has been handed to the host, is the closest
+// observable point.
+type Timing struct {
+	// Sent is when the request and its body were handed to the host, for
+	// a streamed body of unknown length once its last chunk was written
+	Sent time.Duration
+	// FirstByte is when the response headers became available
+	FirstByte time.Duration
+	// Complete is when the response body was read to its end or closed,
+	// zero while the body is still being streamed
+	Complete time.Duration
+}
+
+type timingKey struct{}
+
+func withTiming(request *http.Request, timing *Timing) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), timingKey{}, timing))
+}
+
+// TimingFromResponse returns the timing of the request that produced
+// response, or nil if it was not made by WasiHttpTransport. The returned
+// value is updated in place once the body completes.
+func TimingFromResponse(response *http.Response) *Timing {
+	if response == nil || response.Request == nil {
+		return nil
+	}
+	timing, _ := response.Request.Context().Value(timingKey{}).(*Timing)
+	return timing
+}
@@ -0,0 +1,307 @@
+package roundtrip
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoWasiHost is returned by WasiHttpTransport when the program does not
+// run as a WASI component
+var ErrNoWasiHost = errors.New("roundtrip: WasiHttpTransport only works inside a WASI host; build the component with tinygo -target=wasi and call roundtrip.Install() to route net/http through wasi:http")
+
+// WasiHttpTransport is a http.RoundTripper sending requests through the
+// wasi:http outgoing handler.
+//
+// The request body can be any io.ReadCloser; it is streamed as it is read
+// and closed once the request has been sent, or on any error. Each round
+// trip sends the body once: requests that may have to resend it, like
+// redirects followed by http.Client, need Request.GetBody to obtain a fresh
+// copy.
+type WasiHttpTransport struct {
+	// Proxy returns the proxy to send a request through, or nil for a direct
+	// request, like http.Transport.Proxy. If Proxy is nil,
+	// http.ProxyFromEnvironment is used.
+	//
+	// The host builds the request line from the scheme, authority and path
+	// it is given, so the absolute-form of RFC 9112 cannot be sent: a
+	// proxied request goes to the proxy in origin-form, with a Host header
+	// naming the target, which suits proxies that route on Host. wasi:http
+	// gives no access to the raw connection either, so https requests
+	// cannot be tunneled with CONNECT and fail when a proxy is selected.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// RetryPolicy retries requests answered with 429 or 503 when set
+	RetryPolicy *RetryPolicy
+
+	// Timeout bounds requests whose context has no deadline, zero means no
+	// timeout. A deadline set on the request context, for example with
+	// http.NewRequestWithContext and context.WithTimeout, always takes
+	// precedence, so a single call can use a different timeout without
+	// changing the shared transport.
+	Timeout time.Duration
+}
+
+// timeoutFor returns the time left for request, if it is bounded at all
+func (t WasiHttpTransport) timeoutFor(request *http.Request) (time.Duration, bool) {
+	if deadline, ok := request.Context().Deadline(); ok {
+		return time.Until(deadline), true
+	}
+	if t.Timeout > 0 {
+		return t.Timeout, true
+	}
+	return 0, false
+}
+
+// timeoutMillis converts a timeout to the milliseconds of a wasi:http
+// request option, capped at the largest one. Less than a millisecond left
+// is reported as expired rather than sent as a zero timeout.
+func timeoutMillis(timeout time.Duration) (uint32, bool) {
+	if timeout < time.Millisecond {
+		return 0, false
+	}
+	ms := timeout.Milliseconds()
+	if ms > math.MaxUint32 {
+		return math.MaxUint32, true
+	}
+	return uint32(ms), true
+}
+
+func (t WasiHttpTransport) proxyFor(request *http.Request) (*url.URL, error) {
+	proxy := t.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	proxyUrl, err := proxy(request)
+	if err != nil || proxyUrl == nil {
+		return nil, err
+	}
+	if strings.ToLower(request.URL.Scheme) == "https" {
+		return nil, fmt.Errorf("roundtrip: cannot tunnel https request through proxy %s over wasi:http", proxyUrl.Host)
+	}
+	return proxyUrl, nil
+}
+
+func proxyAuthorization(user *url.Userinfo) string {
+	password, _ := user.Password()
+	credentials := user.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// bodyCounter counts the response bodies that are not closed yet
+type bodyCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *bodyCounter) add(delta int) {
+	c.mu.Lock()
+	c.n += delta
+	c.mu.Unlock()
+}
+
+var openBodies bodyCounter
+
+// countedBody is a response body counted by OpenBodies until it is closed
+type countedBody struct {
+	io.ReadCloser
+	closed sync.Once
+}
+
+// countBody counts body as open until it is first closed
+func countBody(body io.ReadCloser) io.ReadCloser {
+	openBodies.add(1)
+	return &countedBody{
+		ReadCloser: body,
+	}
+}
+
+func (b *countedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closed.Do(func() {
+		openBodies.add(-1)
+	})
+	return err
+}
+
+// OpenBodies returns the number of response bodies returned by
+// WasiHttpTransport that are not closed yet. Each of them holds on to an
+// incoming response and its body stream on the host, so a number that keeps
+// growing points to bodies that are never closed.
+func OpenBodies() int {
+	openBodies.mu.Lock()
+	defer openBodies.mu.Unlock()
+	return openBodies.n
+}
+
+var installOnce sync.Once
+
+// Install makes WasiHttpTransport the transport of http.DefaultClient and
+// http.DefaultTransport. Calling it more than once has no effect.
+func Install() {
+	installOnce.Do(func() {
+		http.DefaultTransport = WasiHttpTransport{}
+		http.DefaultClient.Transport = WasiHttpTransport{}
+	})
+}
+
+// isFramingHeader reports whether key is a header describing the message
+// framing. Like net/http, those are derived from the request fields instead
+// of being copied from the request headers.
+func isFramingHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Content-Length", "Transfer-Encoding":
+		return true
+	default:
+		return false
+	}
+}
+
+// framingHeaders returns the headers describing how the request body is
+// framed. A body of known length is sent with its Content-Length, a body of
+// unknown length (ContentLength -1, or 0 with a non-empty Body) is streamed
+// with chunked transfer-encoding.
+func framingHeaders(request *http.Request) map[string]string {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if isChunked(request) {
+		return map[string]string{
+			"Transfer-Encoding": "chunked",
+		}
+	}
+	return map[string]string{
+		"Content-Length": strconv.FormatInt(request.ContentLength, 10),
+	}
+}
+
+// requestTarget returns the scheme, authority and path with query to hand to
+// the host for request, which go to the proxy when there is one
+func requestTarget(request *http.Request, proxyUrl *url.URL) (scheme string, authority string, pathAndQuery string) {
+	pathAndQuery = request.URL.Path
+	if request.URL.RawQuery != "" {
+		pathAndQuery += "?" + request.URL.RawQuery
+	}
+	if proxyUrl != nil {
+		return proxyUrl.Scheme, proxyUrl.Host, pathAndQuery
+	}
+
+	authority = request.URL.Host
+	if userPassword := request.URL.User.String(); userPassword != "" {
+		authority = userPassword + "@" + authority
+	}
+	return request.URL.Scheme, authority, pathAndQuery
+}
+
+// outgoingHeaders returns the headers to send with request: its own headers
+// with canonical names, the framing headers, the Host header when it
+// differs from the authority the request is sent to, and the proxy
+// credentials. Every header is validated.
+func outgoingHeaders(request *http.Request, proxyUrl *url.URL) (http.Header, error) {
+	header := http.Header{}
+	for key, values := range request.Header {
+		if isFramingHeader(key) || http.CanonicalHeaderKey(key) == "Host" {
+			continue
+		}
+		for _, value := range values {
+			if err := validateHeader(key, value); err != nil {
+				return nil, err
+			}
+			header.Add(key, value)
+		}
+	}
+	for key, value := range framingHeaders(request) {
+		header.Set(key, value)
+	}
+	host, ok := hostHeader(request)
+	if !ok && proxyUrl != nil {
+		host, ok = request.URL.Host, true
+	}
+	if ok {
+		if err := validateHeader("Host", host); err != nil {
+			return nil, err
+		}
+		header.Set("Host", host)
+	}
+	if proxyUrl != nil && proxyUrl.User != nil {
+		header.Set("Proxy-Authorization", proxyAuthorization(proxyUrl.User))
+	}
+	return header, nil
+}
+
+// hostHeader returns the Host header to send when request.Host differs
+// from the host of the URL. The request is still sent to the URL host, so
+// a request to 127.0.0.1:9999 can present itself as Host: api.internal.
+// As with net/http, a Host in request.Header is ignored.
+func hostHeader(request *http.Request) (string, bool) {
+	if request.Host == "" || request.Host == request.URL.Host {
+		return "", false
+	}
+	return request.Host, true
+}
+
+// methodCase returns the method to send for a request method, and whether
+// it goes in the other case of the wasi:http method variant. Methods are
+// case-sensitive, so only the exact standard tokens have their own cases;
+// an empty method is GET, and anything else must be a token to be sent as
+// other.
+func methodCase(method string) (name string, other bool, err error) {
+	switch method {
+	case "":
+		return http.MethodGet, false, nil
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace, http.MethodPatch:
+		return method, false, nil
+	default:
+		if !isToken(method) {
+			return "", false, fmt.Errorf("net/http: invalid method %q", method)
+		}
+		return method, true, nil
+	}
+}
+
+// isChunked reports whether the request body has an unknown length
+func isChunked(request *http.Request) bool {
+	return request.Body != nil && request.Body != http.NoBody && request.ContentLength <= 0
+}
+
+// validateHeader checks a request header against RFC 7230 section 3.2: the
+// name must be a token and the value must not contain control characters
+// other than horizontal tab, which rules out line breaks.
+func validateHeader(key string, value string) error {
+	if !isToken(key) {
+		return fmt.Errorf("roundtrip: invalid header name %q", key)
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("roundtrip: invalid character %q in value of header %q", c, key)
+		}
+	}
+	return nil
+}
+
+// isToken reports whether s is a token as defined by RFC 7230 section 3.2.6
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
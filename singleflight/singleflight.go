@@ -0,0 +1,52 @@
+// Package singleflight coalesces concurrent calls doing the same work.
+//
+// A Golem worker handles one invocation at a time, so calls only overlap
+// when an invocation runs work on several goroutines, for example while one
+// goroutine waits for a response on the wasi:http poll. Group deduplicates
+// within such an invocation; calls made by separate invocations never
+// overlap and are not coalesced.
+package singleflight
+
+import (
+	"sync"
+)
+
+// Group runs at most one call per key at a time. Callers arriving while a
+// call for their key is in flight wait for it and share its result.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+type call[T any] struct {
+	done  sync.WaitGroup
+	value T
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call and returns its result instead
+func (g *Group[T]) Do(key string, fn func() T) T {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call[T]{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.done.Wait()
+		return c.value
+	}
+	c := &call[T]{}
+	c.done.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.done.Done()
+	}()
+
+	c.value = fn()
+	return c.value
+}
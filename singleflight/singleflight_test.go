@@ -0,0 +1,81 @@
+package singleflight
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoSharesOverlappingCalls(t *testing.T) {
+	var g Group[int]
+	var calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func() int {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return 42
+	}
+
+	const callers = 8
+	results := make(chan int, callers)
+	go func() { results <- g.Do("total", fn) }()
+	<-started
+
+	var waiting sync.WaitGroup
+	waiting.Add(callers - 1)
+	for i := 1; i < callers; i++ {
+		go func() {
+			waiting.Done()
+			results <- g.Do("total", fn)
+		}()
+	}
+	waiting.Wait()
+	// Give the callers time to reach Do while the first call is in flight
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < callers; i++ {
+		if result := <-results; result != 42 {
+			t.Errorf("Do = %d, want 42", result)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn ran %d times, want once", calls)
+	}
+}
+
+func TestDoRunsAgainAfterCompletion(t *testing.T) {
+	var g Group[int]
+	calls := 0
+	fn := func() int {
+		calls++
+		return calls
+	}
+	if first, second := g.Do("total", fn), g.Do("total", fn); first != 1 || second != 2 {
+		t.Errorf("Do = %d then %d, want 1 then 2", first, second)
+	}
+}
+
+func TestDoKeysAreIndependent(t *testing.T) {
+	var g Group[string]
+	release := make(chan struct{})
+	done := make(chan string)
+	go func() {
+		done <- g.Do("a", func() string {
+			<-release
+			return "a"
+		})
+	}()
+
+	if result := g.Do("b", func() string { return "b" }); result != "b" {
+		t.Errorf("Do(b) = %q, want b", result)
+	}
+	close(release)
+	if result := <-done; result != "a" {
+		t.Errorf("Do(a) = %q, want a", result)
+	}
+}
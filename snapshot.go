@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// snapshotVersion is the version of the snapshots SaveSnapshot writes
+const snapshotVersion = 3
+
+// SnapshotEnvelope wraps the counter state with the version of its layout,
+// so that a newer component can still read the snapshots of older ones
+type SnapshotEnvelope struct {
+	Version uint32
+	Payload []byte
+}
+
+// snapshotV1 is the first layout, holding only the total
+type snapshotV1 struct {
+	Total uint64
+}
+
+// snapshotV2 adds the deltas not flushed yet, the history, the outcome of
+// the last publish and the state of the publish circuit breaker. Missing
+// parts are restored empty: no history, never published, circuit closed.
+type snapshotV2 struct {
+	Total       uint64
+	Delta       uint64
+	History     []operationSnapshot
+	LastPublish publishStatusSnapshot
+	Breaker     breakerSnapshot
+}
+
+// snapshotV3 adds whether anything was ever added to the total
+type snapshotV3 struct {
+	snapshotV2
+	Initialized bool
+}
+
+type operationSnapshot struct {
+	Kind  operationKind
+	Value uint64
+	At    time.Time
+	Total uint64
+}
+
+type publishStatusSnapshot struct {
+	Published bool
+	At        time.Time
+	Error     string
+}
+
+func snapshotHistory() []operationSnapshot {
+	operations := make([]operationSnapshot, 0, len(history))
+	for _, op := range history {
+		operations = append(operations, operationSnapshot{
+			Kind:  op.kind,
+			Value: op.value,
+			At:    op.at,
+			Total: op.total,
+		})
+	}
+	return operations
+}
+
+func restoreHistory(operations []operationSnapshot) {
+	history = make([]operation, 0, len(operations))
+	for _, op := range operations {
+		history = append(history, operation{
+			kind:  op.Kind,
+			value: op.Value,
+			at:    op.At,
+			total: op.Total,
+		})
+	}
+}
+
+func snapshotLastPublish() publishStatusSnapshot {
+	status := publishStatusSnapshot{
+		Published: lastPublish.published,
+		At:        lastPublish.at,
+	}
+	if lastPublish.err != nil {
+		status.Error = lastPublish.err.Error()
+	}
+	return status
+}
+
+func restoreLastPublish(status publishStatusSnapshot) {
+	lastPublish = publishStatus{
+		published: status.Published,
+		at:        status.At,
+	}
+	if status.Error != "" {
+		lastPublish.err = errors.New(status.Error)
+	}
+}
+
+// snapshotMigrations upgrade the payload of a version to the next version
+var snapshotMigrations = map[uint32]func([]byte) ([]byte, error){
+	1: migrateSnapshotV1,
+	2: migrateSnapshotV2,
+}
+
+func migrateSnapshotV1(payload []byte) ([]byte, error) {
+	var v1 snapshotV1
+	if err := json.Unmarshal(payload, &v1); err != nil {
+		return nil, err
+	}
+	// Deltas were not part of the state yet, nothing is pending
+	return json.Marshal(snapshotV2{
+		Total: v1.Total,
+	})
+}
+
+func migrateSnapshotV2(payload []byte) ([]byte, error) {
+	var v2 snapshotV2
+	if err := json.Unmarshal(payload, &v2); err != nil {
+		return nil, err
+	}
+	// A counter that has a total, pending deltas or recorded additions had
+	// something added to it
+	initialized := v2.Total != 0 || v2.Delta != 0
+	for _, op := range v2.History {
+		if op.Kind == operationAdd {
+			initialized = true
+		}
+	}
+	return json.Marshal(snapshotV3{
+		snapshotV2:  v2,
+		Initialized: initialized,
+	})
+}
+
+// SaveSnapshot returns the counter state as a versioned snapshot
+func (e GogolemTestImpl) SaveSnapshot() []byte {
+	payload, _ := json.Marshal(snapshotV3{
+		snapshotV2: snapshotV2{
+			Total:       total,
+			Delta:       delta,
+			History:     snapshotHistory(),
+			LastPublish: snapshotLastPublish(),
+			Breaker:     e.publishBreaker.snapshot(),
+		},
+		Initialized: initialized,
+	})
+	snapshot, _ := json.Marshal(SnapshotEnvelope{
+		Version: snapshotVersion,
+		Payload: payload,
+	})
+	return snapshot
+}
+
+// loadSnapshot restores the counter state from a snapshot of this or an
+// earlier version. The state is left unchanged if the snapshot cannot be
+// read, including when it comes from a newer version.
+func (e GogolemTestImpl) loadSnapshot(snapshot []byte) error {
+	state, err := readSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	total = state.Total
+	delta = state.Delta
+	initialized = state.Initialized
+	restoreHistory(state.History)
+	restoreLastPublish(state.LastPublish)
+	e.publishBreaker.restore(state.Breaker)
+	return nil
+}
+
+func readSnapshot(snapshot []byte) (snapshotV3, error) {
+	var state snapshotV3
+
+	var envelope SnapshotEnvelope
+	if err := json.Unmarshal(snapshot, &envelope); err != nil {
+		return state, fmt.Errorf("Failed to read snapshot: %v", err)
+	}
+	if envelope.Version == 0 || envelope.Version > snapshotVersion {
+		return state, fmt.Errorf("Unsupported snapshot version %d, this component reads versions 1 to %d", envelope.Version, snapshotVersion)
+	}
+
+	payload := envelope.Payload
+	for version := envelope.Version; version < snapshotVersion; version++ {
+		var err error
+		payload, err = snapshotMigrations[version](payload)
+		if err != nil {
+			return state, fmt.Errorf("Failed to migrate snapshot from version %d: %v", version, err)
+		}
+	}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return state, fmt.Errorf("Failed to read snapshot: %v", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadSnapshotMigratesV1(t *testing.T) {
+	payload, _ := json.Marshal(snapshotV1{Total: 42})
+	snapshot, _ := json.Marshal(SnapshotEnvelope{Version: 1, Payload: payload})
+
+	state, err := readSnapshot(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Total != 42 || state.Delta != 0 || len(state.History) != 0 || state.LastPublish.Published || !state.Initialized {
+		t.Fatalf("migrated state = %+v", state)
+	}
+}
+
+func TestReadSnapshotMigratesV2(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       snapshotV2
+		initialized bool
+	}{
+		{"never added", snapshotV2{}, false},
+		{"added", snapshotV2{Total: 5, Delta: 5}, true},
+		{"added then reset", snapshotV2{History: []operationSnapshot{
+			{Kind: operationAdd, Value: 5, Total: 5},
+			{Kind: operationReset, Value: 5},
+		}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, _ := json.Marshal(test.state)
+			snapshot, _ := json.Marshal(SnapshotEnvelope{Version: 2, Payload: payload})
+
+			state, err := readSnapshot(snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Initialized != test.initialized {
+				t.Fatalf("initialized = %v, want %v", state.Initialized, test.initialized)
+			}
+		})
+	}
+}
+
+func TestReadSnapshotRejectsNewerVersion(t *testing.T) {
+	snapshot, _ := json.Marshal(SnapshotEnvelope{Version: snapshotVersion + 1, Payload: []byte("{}")})
+	if _, err := readSnapshot(snapshot); err == nil {
+		t.Fatal("expected an error for a newer snapshot version")
+	}
+}
+
+// resetState puts the counter state back to a fresh worker's once the test
+// is done
+func resetState(t *testing.T) {
+	t.Cleanup(func() {
+		total, delta, initialized, history, lastPublish = 0, 0, false, nil, publishStatus{}
+	})
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	resetState(t)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := GogolemTestImpl{publishBreaker: newCircuitBreaker(1, time.Minute)}
+	total, delta = 7, 3
+	history = []operation{{kind: operationAdd, value: 7, at: at, total: 7}}
+	lastPublish = publishStatus{published: true, at: at, err: errors.New("publish failed with status 503")}
+
+	initialized = true
+
+	snapshot := e.SaveSnapshot()
+	total, delta, initialized, history, lastPublish = 0, 0, false, nil, publishStatus{}
+
+	if err := e.loadSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := e.getChecked(); !ok || got != 7 {
+		t.Fatalf("getChecked after restore = %d, %v, want 7", got, ok)
+	}
+	if total != 7 || delta != 3 {
+		t.Fatalf("total, delta = %d, %d, want 7, 3", total, delta)
+	}
+	if len(history) != 1 || history[0].value != 7 || !history[0].at.Equal(at) {
+		t.Fatalf("history = %+v", history)
+	}
+	if !lastPublish.published || lastPublish.err == nil || lastPublish.err.Error() != "publish failed with status 503" {
+		t.Fatalf("last publish = %+v", lastPublish)
+	}
+}
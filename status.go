@@ -0,0 +1,24 @@
+package main
+
+import (
+	"time"
+)
+
+// publishStatus is the outcome of the most recent Publish
+type publishStatus struct {
+	published bool
+	at        time.Time
+	err       error
+}
+
+// lastPublish is the zero publishStatus until Publish is first called
+var lastPublish publishStatus
+
+// recordPublish remembers the outcome of a Publish
+func recordPublish(err error) {
+	lastPublish = publishStatus{
+		published: true,
+		at:        now(),
+		err:       err,
+	}
+}